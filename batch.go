@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"github.com/zaibyte/nanozap/buffer"
+	"github.com/zaibyte/nanozap/internal/bufferpool"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// batch combines the entries popped in a row which have the same
+// zapcore.BatchCore into one write.
+// It's only used by the consumer of ring (with writeMu held).
+type batch struct {
+	maxEntries int // Disabled if <= 0.
+	maxBytes   int // No limit if <= 0.
+
+	// log is the Logger whose core is batched. Each Logger has a fixed core,
+	// so comparing loggers tells whether the core changes without comparing
+	// the interfaces, which panics if the core isn't a comparable type.
+	log  *Logger
+	core zapcore.BatchCore
+	buf  *buffer.Buffer
+	n    int
+	sync bool // Sync after writing if there is entry above ErrorLevel.
+}
+
+// write writes lb through its core, then frees it. If lb's core is a
+// zapcore.BatchCore, lb may be only appended to the batch.
+func (b *batch) write(lb *logBody) {
+	bc, ok := lb.core.(zapcore.BatchCore)
+	if b.maxEntries <= 0 || !ok {
+		b.flush()
+		write(lb)
+		return
+	}
+
+	if b.log != lb.log {
+		b.flush()
+	}
+	if !bc.Enabled(lb.lvl) {
+		lb.free()
+		return
+	}
+
+	if b.buf == nil {
+		b.buf = bufferpool.Get()
+	}
+	n := b.buf.Len()
+	if err := bc.AppendEntry(b.buf, entry(lb), lb.fields); err == nil {
+		b.log = lb.log
+		b.core = bc
+		b.n++
+		b.sync = b.sync || lb.lvl > ErrorLevel
+	} else {
+		b.buf.Truncate(n) // Drop the partial entry.
+	}
+	lb.free()
+
+	if b.n >= b.maxEntries || (b.maxBytes > 0 && b.buf.Len() >= b.maxBytes) {
+		b.flush()
+	}
+}
+
+// flush writes the entries in batch out.
+func (b *batch) flush() {
+	if b.n == 0 {
+		return
+	}
+	_ = b.core.WriteBatch(b.buf)
+	if b.sync {
+		_ = b.core.Sync()
+	}
+	b.buf.Reset()
+	b.log = nil
+	b.core = nil
+	b.n = 0
+	b.sync = false
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaibyte/nanozap/buffer"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func testBatch(t *testing.T, maxEntries, maxBytes int, f func(*Logger)) (out *gatedWriter, lines int) {
+	out = newGatedWriter()
+	logger := newTestLogger(out, InfoLevel, WithBatch(maxEntries, maxBytes))
+
+	f(logger)
+	out.open()
+	assert.NoError(t, logger.Close(context.Background()))
+	return out, strings.Count(out.String(), "\n")
+}
+
+func TestBatch(t *testing.T) {
+	n := 128
+	out, lines := testBatch(t, 16, 0, func(logger *Logger) {
+		for i := 0; i < n; i++ {
+			logger.Info(uint64(i), "batch")
+			logger.Debug(uint64(i), "disabled")
+		}
+	})
+	assert.Equal(t, n, lines, "Expected all enabled entries written.")
+	assert.True(t, out.writes <= n/16+1, "Expected entries combined, got %d writes.", out.writes)
+	assert.NotContains(t, out.String(), "disabled")
+}
+
+func TestBatch_MaxBytes(t *testing.T) {
+	n := 64
+	out, lines := testBatch(t, n, 1, func(logger *Logger) {
+		for i := 0; i < n; i++ {
+			logger.Info(uint64(i), "batch")
+		}
+	})
+	assert.Equal(t, n, lines)
+	assert.Equal(t, n, out.writes, "Expected each entry reaching maxBytes.")
+}
+
+func TestBatch_Children(t *testing.T) {
+	n := 64
+	out, lines := testBatch(t, n, 0, func(logger *Logger) {
+		child := logger.With(String("k", "v"))
+		for i := 0; i < n; i++ {
+			logger.Info(uint64(i), "parent")
+			child.Info(uint64(i), "child")
+		}
+	})
+	assert.Equal(t, 2*n, lines)
+	assert.Equal(t, n, strings.Count(out.String(), `"msg":"child","reqid"`))
+	assert.Equal(t, n, strings.Count(out.String(), `"k":"v"`), "Expected child's context in its entries only.")
+}
+
+// sliceCore is a zapcore.BatchCore which isn't comparable, and it fails
+// appending the entries with the message in fails after writing a part of them.
+type sliceCore struct {
+	out   *Bufferer
+	fails []string
+}
+
+func (c sliceCore) Enabled(zapcore.Level) bool { return true }
+func (c sliceCore) With([]Field) zapcore.Core  { return c }
+func (c sliceCore) Sync() error                { return nil }
+
+func (c sliceCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+func (c sliceCore) Write(ent zapcore.Entry, _ []Field) error {
+	_, err := c.out.Write([]byte(ent.Message + "\n"))
+	return err
+}
+
+func (c sliceCore) AppendEntry(buf *buffer.Buffer, ent zapcore.Entry, _ []Field) error {
+	buf.AppendString(ent.Message)
+	for _, f := range c.fails {
+		if f == ent.Message {
+			return errors.New("fail")
+		}
+	}
+	buf.AppendByte('\n')
+	return nil
+}
+
+func (c sliceCore) WriteBatch(buf *buffer.Buffer) error {
+	_, err := c.out.Write(buf.Bytes())
+	return err
+}
+
+func TestBatch_NonComparableCore(t *testing.T) {
+	out := &Bufferer{}
+	logger := New(sliceCore{out: out, fails: []string{"bad"}}, WithBatch(16, 0))
+	child := logger.With(String("k", "v"))
+
+	assert.NotPanics(t, func() {
+		for i := 0; i < 4; i++ {
+			logger.Info(uint64(i), "parent")
+			logger.Info(uint64(i), "bad")
+			child.Info(uint64(i), "child")
+		}
+		assert.NoError(t, logger.Close(context.Background()))
+	})
+	assert.Equal(t, strings.Repeat("parent\nchild\n", 4), out.String(), "Expected failed entries dropped entirely.")
+}
@@ -31,21 +31,48 @@ var (
 	getLogBody   = _logBodyPool.get
 )
 
+// _maxPooledFields is the largest fields capacity a logBody may keep after
+// being reused, avoiding a few huge entries pinning memory in the pool.
+const _maxPooledFields = 32
+
 type logBody struct {
-	lvl   zapcore.Level
-	msg   string
-	reqid uint64
-	pool  logBodyPool
+	core   zapcore.Core // The core of the Logger which pushed this body.
+	log    *Logger      // The Logger which pushed this body, a comparable key of core.
+	time   int64        // When the log method was called, in nanoseconds.
+	pc     uintptr      // The caller of the log method, 0 if not added.
+	stack  *stacktrace  // The stack of the log call, nil if not added.
+	lvl    zapcore.Level
+	msg    string
+	reqid  uint64
+	fields []zapcore.Field
+	pool   logBodyPool
 }
 
 func (b *logBody) free() {
+	b.reset() // Don't keep the references alive in the pool.
 	b.pool.put(b)
 }
 
 func (b *logBody) reset() {
+	b.core = nil
+	b.log = nil
+	b.time = 0
+	b.pc = 0
+	if b.stack != nil {
+		b.stack.free()
+		b.stack = nil
+	}
 	b.lvl = InfoLevel
 	b.msg = ""
 	b.reqid = 0
+	if cap(b.fields) > _maxPooledFields {
+		b.fields = nil
+		return
+	}
+	for i := range b.fields {
+		b.fields[i] = zapcore.Field{} // Don't keep references to the old values.
+	}
+	b.fields = b.fields[:0]
 }
 
 type logBodyPool struct {
@@ -66,7 +93,6 @@ func newLogBodyPool() logBodyPool {
 
 func (p logBodyPool) get() *logBody {
 	buf := p.p.Get().(*logBody)
-	buf.reset()
 	buf.pool = p
 	return buf
 }
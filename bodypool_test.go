@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func TestLogBody_FreeResets(t *testing.T) {
+	logger := &Logger{core: zapcore.NewCore(
+		zapcore.NewJSONEncoder(defaultEncoderConf()),
+		&Discarder{},
+		DebugLevel,
+	)}
+	pool := newLogBodyPool()
+
+	lb := pool.get()
+	lb.core = logger.core
+	lb.log = logger
+	lb.stack = captureStacktrace(0)
+	lb.lvl = ErrorLevel
+	lb.msg = "msg"
+	lb.reqid = 1
+	lb.fields = append(lb.fields, String("k", "v"))
+	lb.free()
+
+	assert.Nil(t, lb.core, "Expected core released.")
+	assert.Nil(t, lb.log, "Expected logger released.")
+	assert.Nil(t, lb.stack, "Expected stack returned.")
+	assert.Equal(t, InfoLevel, lb.lvl)
+	assert.Empty(t, lb.msg)
+	assert.Zero(t, lb.reqid)
+	assert.Empty(t, lb.fields)
+	assert.Equal(t, zapcore.Field{}, lb.fields[:1][0], "Expected fields released.")
+}
@@ -107,6 +107,14 @@ func (b *Buffer) TrimNewline() {
 	}
 }
 
+// Truncate discards all but the first n bytes of the buffer. It does nothing
+// if n is out of range.
+func (b *Buffer) Truncate(n int) {
+	if n >= 0 && n < len(b.bs) {
+		b.bs = b.bs[:n]
+	}
+}
+
 // Free returns the Buffer to its Pool.
 //
 // Callers must not retain references to the Buffer after calling Free.
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// filter selects entries. The zero value selects all.
+type filter struct {
+	level    zapcore.Level
+	hasLevel bool
+	reqID    uint64
+	hasReqID bool
+	since    int64 // Unix nanoseconds, inclusive, 0 means no limit.
+	until    int64 // Unix nanoseconds, exclusive, 0 means no limit.
+	grep     string
+}
+
+func (f *filter) match(ent zapcore.Entry) bool {
+	if f.hasLevel && !f.level.Enabled(ent.Level) {
+		return false
+	}
+	if f.hasReqID && ent.ReqID != f.reqID {
+		return false
+	}
+	if f.since != 0 && ent.Time < f.since {
+		return false
+	}
+	if f.until != 0 && ent.Time >= f.until {
+		return false
+	}
+	if f.grep != "" && !strings.Contains(ent.Message, f.grep) {
+		return false
+	}
+	return true
+}
+
+func (f *filter) setLevel(s string) error {
+	if s == "" {
+		return nil
+	}
+	f.hasLevel = true
+	return f.level.UnmarshalText([]byte(s))
+}
+
+func (f *filter) setReqID(s string) (err error) {
+	if s == "" {
+		return nil
+	}
+	f.hasReqID = true
+	f.reqID, err = strconv.ParseUint(s, 10, 64)
+	return
+}
+
+// parseTime parses a time flag, it could be a duration before now (e.g. "1h"),
+// or a time in RFC3339 format or "2006-01-02 15:04:05" (local time).
+func parseTime(s string, now time.Time) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d).UnixNano(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.UnixNano(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t.UnixNano(), nil
+	}
+	return 0, fmt.Errorf("illegal time: %q", s)
+}
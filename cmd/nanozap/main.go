@@ -0,0 +1,277 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// nanozap views the JSON logs written by nanozap, e.g. the output of zaproll.
+//
+// Usage:
+//
+//	nanozap [flags] path
+//
+// It reads the backups of path (see -backups) and then path itself, and prints
+// the matched entries in console format (reading the standard input if path
+// is "-"). With -f, it keeps waiting for new entries and follows the rotations
+// until it's interrupted.
+//
+// Examples:
+//
+//	nanozap -f -level warn /var/log/app/app.log
+//	nanozap -backups -1 -reqid 42 -since 1h /var/log/app/app.log
+//	nanozap -since "2020-01-02 15:04:05" -until 2020-01-02T16:00:00Z -grep timeout app.log
+//
+// The keys and the encoders of logs could be set by -config, which is an
+// EncoderConfig in JSON (e.g. {"timeKey":"ts","timeEncoder":"millis"}).
+// By default, keys are time, level, msg, reqid, caller & stacktrace,
+// and the time encoder is detected.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/zaibyte/nanozap"
+	"github.com/zaibyte/nanozap/zapcore"
+	"github.com/zaibyte/nanozap/zapread"
+	"github.com/zaibyte/nanozap/zaproll"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("nanozap", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "follow the new entries & rotations")
+	backups := fs.Int("backups", 0, "read the newest n backups first, -1 for all")
+	level := fs.String("level", "", "minimum level, e.g. warn")
+	reqID := fs.String("reqid", "", "only show this reqid")
+	since := fs.String("since", "", "show entries since the time (RFC3339, \"2006-01-02 15:04:05\" or duration ago, e.g. 1h)")
+	until := fs.String("until", "", "show entries before the time, same format as -since")
+	grep := fs.String("grep", "", "only show entries whose message contains the string")
+	color := fs.String("color", "auto", "colorize the output: auto, always or never")
+	config := fs.String("config", "", "encoder config (JSON) of the logs")
+	poll := fs.Duration("poll", 200*time.Millisecond, "polling interval of -f")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: nanozap [flags] path")
+		fs.PrintDefaults()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	v := &viewer{errOut: os.Stderr}
+	now := time.Now()
+	var err error
+	if err = v.filter.setLevel(*level); err == nil {
+		if err = v.filter.setReqID(*reqID); err == nil {
+			if v.filter.since, err = parseTime(*since, now); err == nil {
+				v.filter.until, err = parseTime(*until, now)
+			}
+		}
+	}
+	if err != nil {
+		return fail(err)
+	}
+	v.filter.grep = *grep
+
+	cfg, err := loadConfig(*config)
+	if err != nil {
+		return fail(err)
+	}
+	v.enc = newConsoleEncoder(useColor(*color))
+
+	out := bufio.NewWriter(os.Stdout)
+	v.out = out
+	if *follow {
+		v.out = os.Stdout // Print entries as soon as possible.
+	}
+
+	if path == "-" {
+		err = v.view(zapread.NewReader(os.Stdin, cfg))
+	} else {
+		err = v.viewFiles(path, cfg, *backups, *follow, *poll)
+	}
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return 0
+}
+
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "nanozap: %v\n", err)
+	return 1
+}
+
+// loadConfig loads the encoder config from the file at path,
+// or returns the default one if path is empty.
+func loadConfig(path string) (cfg zapcore.EncoderConfig, err error) {
+	cfg = zapcore.EncoderConfig{
+		TimeKey:       "time",
+		LevelKey:      "level",
+		MessageKey:    "msg",
+		ReqIDKey:      "reqid",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+	}
+	if path == "" {
+		return
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	cfg = zapcore.EncoderConfig{}
+	err = json.Unmarshal(b, &cfg)
+	return
+}
+
+func useColor(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+func newConsoleEncoder(color bool) zapcore.Encoder {
+	cfg := zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		ReqIDKey:       "reqid",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+	if color {
+		cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	return zapcore.NewConsoleEncoder(cfg)
+}
+
+// viewer prints the entries matched.
+type viewer struct {
+	filter filter
+	enc    zapcore.Encoder
+	out    io.Writer
+	errOut io.Writer // For the lines can't be decoded.
+}
+
+// viewFiles views the newest n backups of path and then path.
+func (v *viewer) viewFiles(path string, cfg zapcore.EncoderConfig, n int, follow bool, poll time.Duration) error {
+	var rs []io.Reader
+	if n != 0 {
+		fps, err := zaproll.ListBackups(path)
+		if err != nil {
+			return err
+		}
+		if n > 0 && n < len(fps) {
+			fps = fps[len(fps)-n:]
+		}
+		for _, fp := range fps {
+			f, err := zaproll.OpenBackup(fp) // Backups may be compressed.
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rs = append(rs, f)
+		}
+	}
+
+	done := make(chan struct{})
+	if follow {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(sig)
+		go func() {
+			<-sig
+			close(done)
+		}()
+	}
+	t := &tailReader{path: path, follow: follow, poll: poll, done: done}
+	defer t.Close()
+	rs = append(rs, t)
+
+	return v.view(zapread.NewReader(io.MultiReader(rs...), cfg))
+}
+
+func (v *viewer) view(r *zapread.Reader) error {
+	for {
+		ent, fields, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if _, ok := err.(*zapread.LineError); ok {
+				fmt.Fprintf(v.errOut, "nanozap: %v\n", err)
+				continue
+			}
+			return err
+		}
+		if !v.filter.match(ent) {
+			continue
+		}
+
+		buf, err := v.enc.EncodeEntry(ent, sortFields(fields))
+		if err != nil {
+			return err
+		}
+		_, err = v.out.Write(buf.Bytes())
+		buf.Free()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sortFields makes fields in the order of keys, for a stable output.
+func sortFields(m map[string]interface{}) []zapcore.Field {
+	fields := make([]zapcore.Field, 0, len(m))
+	for k, val := range m {
+		fields = append(fields, nanozap.Reflect(k, val))
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Key < fields[j].Key
+	})
+	return fields
+}
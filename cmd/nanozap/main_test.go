@@ -0,0 +1,256 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zaibyte/nanozap"
+	"github.com/zaibyte/nanozap/zapcore"
+	"github.com/zaibyte/nanozap/zapread"
+	"github.com/zaibyte/nanozap/zaproll"
+)
+
+func TestFilter(t *testing.T) {
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: 100, ReqID: 7, Message: "request timeout"}
+
+	tests := []struct {
+		f      filter
+		expect bool
+	}{
+		{filter{}, true},
+		{filter{level: zapcore.WarnLevel, hasLevel: true}, true},
+		{filter{level: zapcore.ErrorLevel, hasLevel: true}, false},
+		{filter{reqID: 7, hasReqID: true}, true},
+		{filter{reqID: 0, hasReqID: true}, false},
+		{filter{since: 100, until: 101}, true},
+		{filter{since: 101}, false},
+		{filter{until: 100}, false},
+		{filter{grep: "timeout"}, true},
+		{filter{grep: "Timeout"}, false},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.expect, tt.f.match(ent), "Unexpected result of case %d.", i)
+	}
+
+	var f filter
+	assert.NoError(t, f.setLevel(""))
+	assert.False(t, f.hasLevel)
+	assert.Error(t, f.setLevel("unknown"))
+	assert.NoError(t, f.setReqID("0"))
+	assert.True(t, f.hasReqID)
+	assert.Error(t, f.setReqID("-1"))
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	local := time.Date(2020, 1, 2, 15, 4, 5, 0, time.Local)
+
+	tests := []struct {
+		s      string
+		expect int64
+	}{
+		{"", 0},
+		{"1h", now.Add(-time.Hour).UnixNano()},
+		{"2020-01-02T03:04:05.5Z", now.Add(500 * time.Millisecond).UnixNano()},
+		{"2020-01-02 15:04:05", local.UnixNano()},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.s, now)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expect, got, "Unexpected time of %q.", tt.s)
+	}
+
+	_, err := parseTime("yesterday", now)
+	assert.Error(t, err)
+}
+
+func testEncoderConfig() zapcore.EncoderConfig {
+	cfg, _ := loadConfig("")
+	cfg.EncodeLevel = zapcore.LowercaseLevelEncoder
+	cfg.EncodeTime = zapcore.EpochNanosTimeEncoder
+	return cfg
+}
+
+func writeEntries(t *testing.T, w io.Writer, from, to int) {
+	enc := zapcore.NewJSONEncoder(testEncoderConfig())
+	for i := from; i < to; i++ {
+		buf, err := enc.EncodeEntry(zapcore.Entry{Level: zapcore.InfoLevel, ReqID: uint64(i), Message: "msg"}, nil)
+		require.NoError(t, err)
+		_, err = w.Write(buf.Bytes())
+		require.NoError(t, err)
+		buf.Free()
+	}
+}
+
+func TestTailReader_Follow(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "test.log")
+
+	done := make(chan struct{})
+	tr := &tailReader{path: fp, follow: true, poll: time.Millisecond, done: done}
+	defer tr.Close()
+	reqIDs := make(chan uint64, 64)
+	readErr := make(chan error, 1)
+	go func() {
+		r := zapread.NewReader(tr, testEncoderConfig())
+		for {
+			ent, _, err := r.Next()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			reqIDs <- ent.ReqID
+		}
+	}()
+
+	expect := func(from, to int) {
+		for i := from; i < to; i++ {
+			select {
+			case id := <-reqIDs:
+				require.Equal(t, uint64(i), id)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for reqid %d.", i)
+			}
+		}
+	}
+
+	// The file hasn't been created.
+	time.Sleep(5 * time.Millisecond)
+	f, err := os.Create(fp)
+	require.NoError(t, err)
+	writeEntries(t, f, 0, 3)
+	expect(0, 3)
+
+	// Rotated, with some entries written before renaming.
+	writeEntries(t, f, 3, 5)
+	require.NoError(t, os.Rename(fp, fp+".1"))
+	f.Close()
+	f, err = os.Create(fp)
+	require.NoError(t, err)
+	writeEntries(t, f, 5, 7)
+	expect(3, 7)
+
+	// Truncated.
+	require.NoError(t, f.Truncate(0))
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	writeEntries(t, f, 7, 8)
+	expect(7, 8)
+	f.Close()
+
+	close(done)
+	select {
+	case err = <-readErr:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for stopping.")
+	}
+}
+
+func TestViewer_Backups(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "test.log")
+
+	r, err := zaproll.New(&zaproll.Config{
+		OutputPath:   fp,
+		MaxSize:      256,
+		MaxBackups:   100,
+		PerWriteSize: 64,
+		PerSyncSize:  128,
+		Compress:     "gzip", // Some of the backups are compressed before closing.
+		Developed:    true,
+	})
+	require.NoError(t, err)
+	const n = 20
+	for i := 0; i < n; i++ {
+		writeEntries(t, r, i, i+1)
+		time.Sleep(2 * time.Millisecond) // Avoid backups with the same name.
+	}
+	require.NoError(t, r.Sync())
+	require.NoError(t, r.Close())
+	fps, err := zaproll.ListBackups(fp)
+	require.NoError(t, err)
+	require.True(t, len(fps) > 1, "Expected rotations.")
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	v := &viewer{enc: newConsoleEncoder(false), out: out, errOut: errOut}
+	require.NoError(t, v.viewFiles(fp, testEncoderConfig(), -1, false, time.Millisecond))
+	assert.Empty(t, errOut.String())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Equal(t, n, len(lines))
+	epoch := time.Unix(0, 0).Format("2006-01-02T15:04:05.000Z0700")
+	for i, line := range lines {
+		assert.Equal(t, strings.Join([]string{epoch, "INFO", strconv.Itoa(i), "msg"}, "\t"), line)
+	}
+
+	// Without backups.
+	out.Reset()
+	require.NoError(t, v.viewFiles(fp, testEncoderConfig(), 0, false, time.Millisecond))
+	assert.True(t, strings.Count(out.String(), "\n") < n)
+}
+
+func TestViewer_Logger(t *testing.T) {
+	cfg := testEncoderConfig()
+	logs := &bytes.Buffer{}
+	logger := nanozap.New(zapcore.NewCore(zapcore.NewJSONEncoder(cfg), zapcore.AddSync(logs), nanozap.DebugLevel))
+	logger.InfoFields(1, "hello", nanozap.String("b", "x"), nanozap.Int("a", 1))
+	logger.Error(2, "failed")
+	logger.Warn(3, "warned")
+	require.NoError(t, logger.Close(context.Background()))
+	logs.WriteString("not json\n")
+
+	out := &bytes.Buffer{}
+	errOut := &bytes.Buffer{}
+	v := &viewer{enc: zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		LevelKey:    "level",
+		MessageKey:  "msg",
+		ReqIDKey:    "reqid",
+		EncodeLevel: zapcore.CapitalLevelEncoder,
+	}), out: out, errOut: errOut}
+	require.NoError(t, v.filter.setLevel("info"))
+	v.filter.grep = "e"
+	require.NoError(t, v.view(zapread.NewReader(logs, cfg)))
+
+	// Entries may be reordered by the ring.
+	assert.Equal(t, "INFO\t1\thello\t{\"a\": 1, \"b\": \"x\"}\nWARN\t3\twarned\n", strings.Replace(out.String(), "ERROR\t2\tfailed\n", "", 1))
+	assert.Contains(t, out.String(), "ERROR\t2\tfailed\n")
+	assert.Contains(t, errOut.String(), "line 4")
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// tailReader reads the log file at path. If follow is true, it waits for new
+// data at the end of file, and switches to the new file when the old one has
+// been rotated (renamed to backup) or truncated.
+type tailReader struct {
+	path   string
+	follow bool
+	poll   time.Duration
+	done   <-chan struct{} // Stops following, Read returns io.EOF after that.
+
+	f        *os.File
+	rotating bool
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		if t.f == nil {
+			f, err := os.Open(t.path)
+			if err != nil {
+				if !t.follow || !os.IsNotExist(err) {
+					return 0, err
+				}
+				if !t.sleep() {
+					return 0, io.EOF
+				}
+				continue
+			}
+			t.f = f
+		}
+
+		n, err := t.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if !t.follow {
+			return 0, io.EOF
+		}
+
+		if t.rotating {
+			// Nothing more in the old file,
+			// because zaproll won't write it after renaming.
+			t.f.Close()
+			t.f = nil
+			t.rotating = false
+			continue
+		}
+		rotated, err := t.rotated()
+		if err != nil {
+			return 0, err
+		}
+		if rotated {
+			// Read it again, it may be written between
+			// the last Read and the renaming.
+			t.rotating = true
+			continue
+		}
+		if !t.sleep() {
+			return 0, io.EOF
+		}
+	}
+}
+
+// rotated returns true if path points to another file.
+// If the file has been truncated, it seeks to the beginning.
+func (t *tailReader) rotated() (bool, error) {
+	fi, err := os.Stat(t.path)
+	if err != nil {
+		if os.IsNotExist(err) { // Renamed, and the new one hasn't been created.
+			return true, nil
+		}
+		return false, err
+	}
+	cur, err := t.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(fi, cur) {
+		return true, nil
+	}
+
+	off, err := t.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() < off {
+		_, err = t.f.Seek(0, io.SeekStart)
+	}
+	return false, err
+}
+
+// sleep waits for the next polling, it returns false if done.
+func (t *tailReader) sleep() bool {
+	timer := time.NewTimer(t.poll)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+// Close closes the file being read.
+func (t *tailReader) Close() error {
+	if t.f != nil {
+		return t.f.Close()
+	}
+	return nil
+}
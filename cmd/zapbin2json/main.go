@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// zapbin2json converts the binary logs written by zapbin to JSON lines.
+//
+// Usage:
+//
+//	zapbin2json [-time iso8601|millis|nanos|epoch] [-caller full|short] [file ...]
+//
+// It reads the standard input if no file is given.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zaibyte/nanozap/zapbin"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func main() {
+	timeEnc := flag.String("time", "iso8601", "time encoder: iso8601, millis, nanos or epoch")
+	callerEnc := flag.String("caller", "short", "caller encoder: full or short")
+	flag.Parse()
+
+	cfg := zapcore.EncoderConfig{
+		TimeKey:       "time",
+		LevelKey:      "level",
+		MessageKey:    "msg",
+		ReqIDKey:      "reqid",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+		EncodeLevel:   zapcore.LowercaseLevelEncoder,
+	}
+	// The encoders' UnmarshalText fall back to a default for unknown names,
+	// so check the names here.
+	switch *timeEnc {
+	case "iso8601", "ISO8601", "millis", "nanos", "epoch":
+	default:
+		usage("invalid -time %q", *timeEnc)
+	}
+	switch *callerEnc {
+	case "full", "short":
+	default:
+		usage("invalid -caller %q", *callerEnc)
+	}
+	if err := cfg.EncodeTime.UnmarshalText([]byte(*timeEnc)); err != nil {
+		usage("invalid -time %q: %v", *timeEnc, err)
+	}
+	if err := cfg.EncodeCaller.UnmarshalText([]byte(*callerEnc)); err != nil {
+		usage("invalid -caller %q: %v", *callerEnc, err)
+	}
+	_ = cfg.EncodeDuration.UnmarshalText([]byte("string"))
+	enc := zapcore.NewJSONEncoder(cfg)
+
+	out := bufio.NewWriter(os.Stdout)
+	code := 0
+	convert := func(name string, src io.Reader) {
+		if err := zapbin.Convert(out, src, enc); err != nil {
+			fmt.Fprintf(os.Stderr, "zapbin2json: %s: %v\n", name, err)
+			code = 1
+		}
+	}
+
+	if flag.NArg() == 0 {
+		convert("stdin", os.Stdin)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zapbin2json: %v\n", err)
+			code = 1
+			continue
+		}
+		convert(name, f)
+		f.Close()
+	}
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "zapbin2json: %v\n", err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// usage prints the error & usage, then exits with code 2 as flag does.
+func usage(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "zapbin2json: "+format+"\n", args...)
+	fmt.Fprintln(os.Stderr, "usage: zapbin2json [flags] [file ...]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
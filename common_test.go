@@ -21,7 +21,13 @@
 package nanozap
 
 import (
+	"context"
 	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaibyte/nanozap/zapcore"
 )
 
 
@@ -37,3 +43,56 @@ func runConcurrently(goroutines, iterations int, wg *sync.WaitGroup, f func()) {
 		}()
 	}
 }
+
+// newTestLogger creates a Logger which writes JSON entries enabled by enab to out.
+func newTestLogger(out zapcore.WriteSyncer, enab zapcore.LevelEnabler, opts ...Option) *Logger {
+	return New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(defaultEncoderConf()),
+		out,
+		enab,
+	), opts...)
+}
+
+// closeLogger closes logger and checks every pushed entry is written or dropped.
+func closeLogger(t *testing.T, logger *Logger) Stats {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, logger.Close(ctx))
+
+	st := logger.Stats()
+	assert.Equal(t, st.Pushed.Total(), st.Written.Total()+st.Dropped(),
+		"Expected every pushed entry to be written or dropped.")
+	return st
+}
+
+// gatedWriter is a Bufferer which blocks writes until its gate is opened,
+// and takes delay for each write. It also counts the writes.
+type gatedWriter struct {
+	Bufferer
+	gate   chan struct{} // Nil if it isn't gated.
+	delay  time.Duration
+	writes int // Only read after the Logger closed.
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func newSlowWriter(delay time.Duration) *gatedWriter {
+	return &gatedWriter{delay: delay}
+}
+
+func (w *gatedWriter) open() {
+	close(w.gate)
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	if w.gate != nil {
+		<-w.gate
+	}
+	if w.delay > 0 {
+		time.Sleep(w.delay)
+	}
+	w.writes++
+	return w.Bufferer.Write(p)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// encodeByLogger logs through a Logger with enc and returns the output lines.
+func encodeByLogger(t *testing.T, enc zapcore.Encoder, f func(*Logger), opts ...Option) []string {
+	out := &Bufferer{}
+	logger := New(zapcore.NewCore(enc, out, DebugLevel), opts...)
+	f(logger)
+	require.NoError(t, logger.Close(context.Background()))
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestConsoleEncoder(t *testing.T) {
+	conf := defaultEncoderConf()
+	conf.CallerKey = "caller"
+	conf.EncodeCaller = zapcore.ShortCallerEncoder
+	conf.StacktraceKey = "stacktrace"
+
+	lines := encodeByLogger(t, zapcore.NewConsoleEncoder(conf), func(log *Logger) {
+		log.Info(1, "no fields")
+		log.With(String("k", "v")).InfoFields(2, "with fields", Int("n", 1), Strings("ss", []string{"a", "b"}))
+		log.Error(3, "with stack")
+	}, AddCaller(), AddStacktrace(ErrorLevel))
+
+	require.True(t, len(lines) > 4, "Expected stacktrace lines.")
+
+	cols := strings.Split(lines[0], "\t")
+	require.Len(t, cols, 5)
+	assert.Regexp(t, `^\d+$`, cols[0], "Expected time first.")
+	assert.Equal(t, []string{"info", "1"}, cols[1:3])
+	assert.Regexp(t, `encoder_test.go:\d+$`, cols[3], "Unexpected caller.")
+	assert.Equal(t, "no fields", cols[4])
+
+	cols = strings.Split(lines[1], "\t")
+	require.Len(t, cols, 6)
+	assert.Equal(t, "with fields", cols[4])
+	assert.Equal(t, `{"k": "v", "n": 1, "ss": ["a", "b"]}`, cols[5])
+
+	cols = strings.Split(lines[2], "\t")
+	assert.Equal(t, "with stack", cols[len(cols)-1], "Expected stacktrace on the next line.")
+	assert.True(t, strings.HasPrefix(lines[3], "github.com/zaibyte/nanozap.TestConsoleEncoder"))
+}
+
+func TestLogfmtEncoder_Context(t *testing.T) {
+	conf := zapcore.EncoderConfig{
+		MessageKey:    "msg",
+		LevelKey:      "lvl",
+		StacktraceKey: "stack",
+		EncodeLevel:   zapcore.CapitalLevelEncoder,
+	}
+
+	lines := encodeByLogger(t, zapcore.NewLogfmtEncoder(conf), func(log *Logger) {
+		child := log.With(String("svc", "api"), Namespace("req"), Int("id", 1))
+		child.InfoFields(0, "first", String("path", "/"))
+		log.Error(0, "second")
+	}, AddStacktrace(ErrorLevel))
+
+	require.Len(t, lines, 2, "Expected one line for each entry.")
+	assert.Equal(t, `lvl=INFO msg=first svc=api req.id=1 req.path=/`, lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], `lvl=ERROR msg=second stack="github.com/zaibyte/nanozap.TestLogfmtEncoder_Context`),
+		"Expected stacktrace quoted in one line, got: %s.", lines[1])
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func TestAtomicLevelServeHTTP(t *testing.T) {
+	tests := []struct {
+		desc          string
+		method        string
+		query         string
+		contentType   string
+		body          string
+		expectedCode  int
+		expectedLevel zapcore.Level
+	}{
+		{
+			desc:          "GET",
+			method:        http.MethodGet,
+			expectedCode:  http.StatusOK,
+			expectedLevel: InfoLevel,
+		},
+		{
+			desc:          "PUT JSON",
+			method:        http.MethodPut,
+			expectedCode:  http.StatusOK,
+			expectedLevel: WarnLevel,
+			body:          `{"level":"warn"}`,
+		},
+		{
+			desc:          "PUT JSON upper case",
+			method:        http.MethodPut,
+			contentType:   "application/json",
+			expectedCode:  http.StatusOK,
+			expectedLevel: ErrorLevel,
+			body:          `{"level":"ERROR"}`,
+		},
+		{
+			desc:          "PUT URL encoded",
+			method:        http.MethodPut,
+			contentType:   "application/x-www-form-urlencoded",
+			expectedCode:  http.StatusOK,
+			expectedLevel: DebugLevel,
+			body:          "level=debug",
+		},
+		{
+			desc:          "PUT URL encoded with charset",
+			method:        http.MethodPut,
+			contentType:   "application/x-www-form-urlencoded; charset=utf-8",
+			expectedCode:  http.StatusOK,
+			expectedLevel: WarnLevel,
+			body:          "level=warn",
+		},
+		{
+			desc:          "PUT query parameters",
+			method:        http.MethodPut,
+			query:         "?level=debug",
+			contentType:   "application/x-www-form-urlencoded",
+			expectedCode:  http.StatusOK,
+			expectedLevel: DebugLevel,
+		},
+		{
+			desc:          "body takes precedence over query",
+			method:        http.MethodPut,
+			query:         "?level=debug",
+			contentType:   "application/x-www-form-urlencoded",
+			expectedCode:  http.StatusOK,
+			expectedLevel: WarnLevel,
+			body:          "level=warn",
+		},
+		{
+			desc:         "PUT JSON unrecognized",
+			method:       http.MethodPut,
+			expectedCode: http.StatusBadRequest,
+			body:         `{"level":"unrecognized"}`,
+		},
+		{
+			desc:         "PUT URL encoded unrecognized",
+			method:       http.MethodPut,
+			contentType:  "application/x-www-form-urlencoded",
+			expectedCode: http.StatusBadRequest,
+			body:         "level=unrecognized",
+		},
+		{
+			desc:         "PUT JSON malformed",
+			method:       http.MethodPut,
+			expectedCode: http.StatusBadRequest,
+			body:         `{"level":"warn`,
+		},
+		{
+			desc:         "PUT JSON unspecified",
+			method:       http.MethodPut,
+			expectedCode: http.StatusBadRequest,
+			body:         `{}`,
+		},
+		{
+			desc:         "PUT URL encoded unspecified",
+			method:       http.MethodPut,
+			contentType:  "application/x-www-form-urlencoded",
+			expectedCode: http.StatusBadRequest,
+			body:         "",
+		},
+		{
+			desc:         "POST JSON",
+			method:       http.MethodPost,
+			expectedCode: http.StatusMethodNotAllowed,
+			body:         `{"level":"warn"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			lvl := NewAtomicLevel()
+			lvl.SetLevel(InfoLevel)
+
+			ts := httptest.NewServer(lvl)
+			defer ts.Close()
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.query, strings.NewReader(tt.body))
+			require.NoError(t, err, "Error constructing %s request.", tt.method)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			require.NoError(t, err, "Error making %s request.", tt.method)
+			defer res.Body.Close()
+
+			require.Equal(t, tt.expectedCode, res.StatusCode, "Unexpected status code.")
+			if tt.expectedCode != http.StatusOK {
+				var pld struct {
+					Error string `json:"error"`
+				}
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&pld), "Decoding response body")
+				assert.NotEmpty(t, pld.Error, "Expected an error message")
+				assert.Equal(t, InfoLevel, lvl.Level(), "Unexpected logging level changed")
+				return
+			}
+
+			var pld struct {
+				Level zapcore.Level `json:"level"`
+			}
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&pld), "Decoding response body")
+			assert.Equal(t, tt.expectedLevel, pld.Level, "Unexpected logging level returned")
+			assert.Equal(t, tt.expectedLevel, lvl.Level(), "Unexpected logging level set")
+		})
+	}
+}
+
+func TestAtomicLevelServeHTTPRecorder(t *testing.T) {
+	lvl := NewAtomicLevelAt(ErrorLevel)
+
+	rec := httptest.NewRecorder()
+	lvl.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level":"error"}`, rec.Body.String())
+}
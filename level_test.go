@@ -39,6 +39,7 @@ func TestLevelEnablerFunc(t *testing.T) {
 		{InfoLevel, true},
 		{WarnLevel, false},
 		{ErrorLevel, false},
+		{DPanicLevel, false},
 		{PanicLevel, false},
 		{FatalLevel, false},
 	}
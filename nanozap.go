@@ -24,45 +24,149 @@ package nanozap
 import (
 	"context"
 	"fmt"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 	"unsafe"
 
 	"github.com/templexxx/tsc"
 	"github.com/zaibyte/nanozap/zapcore"
+	"go.uber.org/multierr"
 )
 
-// For nanozap, the random order only happens when there is a flood,
-// and random order logs won't cause serious issues.
+// A Logger pushes entries into a ring in log calls, and a background loop
+// writes them out.
+//
+// The default ring may write entries out of order only under a flood with
+// OverwritePolicy (the default): the background loop skips the bucket of a
+// slow log call (it's written in the next round), and the oldest entries are
+// overwritten when the ring is full. Random order logs won't cause serious
+// issues. With the other policies, it waits for the slow log calls and keeps
+// the order. WithOrderedRing keeps the order of log calls with any policy.
+//
+// For both rings, OverwritePolicy and DropNewestPolicy never block log calls,
+// BlockPolicy and LevelAwarePolicy may block them when the ring is full.
 type Logger struct {
 	core zapcore.Core
 
-	ring *Ring
+	ring ring
+
+	// root is the Logger which owns ring & the background loop,
+	// it's nil for the Logger created by New.
+	root *Logger
+
+	// writeMu makes sure there is only one consumer of ring,
+	// the background loop, Close and Panic/Fatal could all write entries out.
+	writeMu sync.Mutex
+
+	dropReport dropReport
+	batch      batch
+
+	overflow     OverflowPolicy
+	blockTimeout time.Duration
+	ringSize     int
+	ordered      bool
+	development  bool
+	addCaller    bool
+	callerSkip   int
+	addStack     zapcore.LevelEnabler
+	idleSpins    int
+	idleYields   int
+	idleWait     time.Duration
 
 	loopCtx    context.Context
 	loopCancel func()
 	loopWg     sync.WaitGroup
 }
 
-// New constructs a new Logger from the provided zapcore.Core. If
+// New constructs a new Logger from the provided zapcore.Core and Options. If
 // the passed zapcore.Core is nil, it panic.
-func New(core zapcore.Core) *Logger {
+func New(core zapcore.Core, opts ...Option) *Logger {
 	if core == nil {
 		panic("empty core")
 	}
 	log := &Logger{
-		core: core,
-		ring: newRandRing(12),
+		core:         core,
+		blockTimeout: _defaultBlockTimeout,
+		ringSize:     _defaultRingSize,
+		idleSpins:    _defaultIdleSpins,
+		idleYields:   _defaultIdleYields,
+		idleWait:     _defaultIdleWait,
+	}
+	for _, opt := range opts {
+		opt.apply(log)
+	}
+	if log.ordered {
+		log.ring = newSeqRing(ringSizeToN(log.ringSize), log.overflow, log.blockTimeout)
+	} else {
+		log.ring = newRandRing(ringSizeToN(log.ringSize), log.overflow, log.blockTimeout)
 	}
 
 	log.startLoop()
 	return log
 }
 
-// Close close Logger background loop.
-// Without guarantee anything except exiting loop.
-func (log *Logger) Close() {
+// With creates a child logger and adds structured context to it. Fields added
+// to the child don't affect the parent, and vice versa.
+//
+// The child shares the parent's ring and background loop, so it costs nothing
+// but a cloned core. Closing the root Logger stops all its children,
+// and Close on a child does nothing.
+func (log *Logger) With(fields ...Field) *Logger {
+	if len(fields) == 0 {
+		return log
+	}
+	root := log.root
+	if root == nil {
+		root = log
+	}
+	return &Logger{
+		core:       log.core.With(fields),
+		ring:       log.ring,
+		root:       root,
+		addCaller:  log.addCaller,
+		callerSkip: log.callerSkip,
+		addStack:   log.addStack,
+	}
+}
+
+// Close stops the background loop, then writes all the entries pushed before
+// Close out and syncs the core.
+//
+// ctx bounds the shutdown time, if it's done before finishing,
+// the entries left in the ring are dropped and ctx.Err() is returned.
+// Close on a child Logger does nothing.
+func (log *Logger) Close(ctx context.Context) error {
+	if log.root != nil {
+		return nil
+	}
+	log.ring.close()
 	log.stopLoop()
+
+	log.writeMu.Lock()
+	defer log.writeMu.Unlock()
+
+	err := log.drain(ctx)
+	return multierr.Append(err, log.core.Sync())
+}
+
+// owner returns the Logger which owns the ring & the background loop.
+func (log *Logger) owner() *Logger {
+	if log.root != nil {
+		return log.root
+	}
+	return log
+}
+
+// drain writes all the entries in ring out,
+// it must be called with writeMu held.
+func (log *Logger) drain(ctx context.Context) error {
+	err := log.ring.Drain(ctx, func(b unsafe.Pointer) {
+		log.batch.write((*logBody)(b))
+	})
+	log.batch.flush()
+	return err
 }
 
 func (log *Logger) startLoop() {
@@ -83,25 +187,115 @@ func (log *Logger) writeLoop() {
 	ctx, cancel := context.WithCancel(log.loopCtx)
 	defer cancel()
 
+	// When there is nothing to write, spin first, then yield the processor,
+	// at last park until new entries pushed (or idleWait passed).
+	// Latency is low in busy time, and the loop won't wake up
+	// again and again in idle time.
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	idle := 0
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
+			log.writeMu.Lock()
 			b, ok := log.ring.TryPop()
-			if !ok {
-				time.Sleep(2 * time.Millisecond) // If no log, wait for 2 millisecond.
+			if ok {
+				log.batch.write((*logBody)(b))
+			} else {
+				log.batch.flush() // Nothing more to combine.
+			}
+			log.reportDrops()
+			log.writeMu.Unlock()
+			if ok {
+				idle = 0
 				continue
 			}
-			lb := (*logBody)(b)
-			if ce := log.check(lb.lvl, lb.msg, lb.reqid); ce != nil {
-				ce.Write()
+
+			idle++
+			switch {
+			case idle <= log.idleSpins:
+			case idle <= log.idleSpins+log.idleYields || log.idleWait <= 0:
+				runtime.Gosched()
+			default:
+				log.ring.wait(ctx.Done(), timer, log.idleWait)
+				idle = 0
 			}
-			lb.free()
 		}
 	}
 }
 
+// write writes lb through its core, then frees it.
+func write(lb *logBody) {
+	if ce := check(lb); ce != nil {
+		ce.Write(lb.fields...)
+	}
+	lb.free()
+}
+
+// push puts a log entry into the ring, the background loop will write it
+// through the core of the Logger which pushed it.
+func (log *Logger) push(lvl zapcore.Level, reqid uint64, msg string, fields []Field) {
+	log.ring.Push(unsafe.Pointer(log.newLogBody(lvl, reqid, msg, fields)))
+}
+
+// writeThenExit bypasses the ring: it writes all the entries pushed before
+// and the entry itself on the caller's goroutine, syncs the core,
+// then panics or exits according to lvl.
+func (log *Logger) writeThenExit(lvl zapcore.Level, reqid uint64, msg string, fields []Field) {
+	root := log.owner()
+	root.writeMu.Lock()
+	_ = root.drain(context.Background())
+	write(log.newLogBody(lvl, reqid, msg, fields))
+	_ = log.core.Sync()
+	root.writeMu.Unlock()
+
+	switch lvl {
+	case DPanicLevel, PanicLevel:
+		panic(msg)
+	case FatalLevel:
+		os.Exit(1)
+	}
+}
+
+// _callerSkip is the count of frames between runtime.Callers and the log site:
+// runtime.Callers, newLogBody, push (or writeThenExit) and the log method.
+// So the log methods must call push or writeThenExit directly.
+const _callerSkip = 4
+
+func (log *Logger) newLogBody(lvl zapcore.Level, reqid uint64, msg string, fields []Field) *logBody {
+	lb := getLogBody()
+	lb.core = log.core
+	lb.log = log
+	lb.time = tsc.UnixNano()
+	if log.addCaller {
+		var pcs [1]uintptr
+		if runtime.Callers(log.callerSkip+_callerSkip, pcs[:]) > 0 {
+			lb.pc = pcs[0]
+		}
+	}
+	if log.addStack != nil && log.addStack.Enabled(lvl) {
+		lb.stack = captureStacktrace(log.callerSkip + _callerSkip)
+	}
+	lb.msg = msg
+	lb.lvl = lvl
+	lb.reqid = reqid
+	lb.fields = append(lb.fields, fields...)
+	for i := range lb.fields {
+		switch f := &lb.fields[i]; f.Type {
+		case zapcore.BinaryType, zapcore.ByteStringType:
+			// Encoded later in the background, copy the bytes which are
+			// often reused by the caller.
+			if b, ok := f.Interface.([]byte); ok {
+				f.Interface = append([]byte(nil), b...)
+			}
+		}
+	}
+	return lb
+}
+
 // Debug logs a message at DebugLevel.
 func (log *Logger) Debug(reqid uint64, msg string) {
 	// Fast check. Debug level is a special case, because we usually use it in developing,
@@ -110,12 +304,7 @@ func (log *Logger) Debug(reqid uint64, msg string) {
 		return
 	}
 
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = DebugLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.push(DebugLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Debugf(reqid uint64, format string, args ...interface{}) {
@@ -125,93 +314,147 @@ func (log *Logger) Debugf(reqid uint64, format string, args ...interface{}) {
 		return
 	}
 
-	lb := getLogBody()
-	lb.msg = fmt.Sprintf(format, args...)
-	lb.lvl = DebugLevel
-	lb.reqid = reqid
+	log.push(DebugLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
 
-	log.ring.Push(unsafe.Pointer(lb))
+// DebugFields logs a message at DebugLevel with the fields passed at the
+// log site.
+func (log *Logger) DebugFields(reqid uint64, msg string, fields ...Field) {
+	// Fast check, see Debug for details.
+	if !log.core.Enabled(DebugLevel) {
+		return
+	}
+
+	log.push(DebugLevel, reqid, msg, fields)
 }
 
 // Info logs a message at InfoLevel.
 func (log *Logger) Info(reqid uint64, msg string) {
-
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = InfoLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.push(InfoLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Infof(reqid uint64, format string, args ...interface{}) {
 
-	log.Info(reqid, fmt.Sprintf(format, args...))
+	log.push(InfoLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
+
+// InfoFields logs a message at InfoLevel with the fields passed at the
+// log site.
+//
+// The fields are encoded later in the background. They are copied into pooled
+// storage with the bytes of Binary and ByteString fields, so the caller may
+// reuse them once InfoFields returns. But the other values they refer to
+// (e.g. the slices of Strings, the marshalers of Object) are not copied and
+// must not be mutated after the call. The same goes for the other XxxFields.
+func (log *Logger) InfoFields(reqid uint64, msg string, fields ...Field) {
+	log.push(InfoLevel, reqid, msg, fields)
 }
 
 // Warn logs a message at WarnLevel.
 func (log *Logger) Warn(reqid uint64, msg string) {
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = WarnLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.push(WarnLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Warnf(reqid uint64, format string, args ...interface{}) {
 
-	log.Warn(reqid, fmt.Sprintf(format, args...))
+	log.push(WarnLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
+
+// WarnFields logs a message at WarnLevel with the fields passed at the
+// log site.
+func (log *Logger) WarnFields(reqid uint64, msg string, fields ...Field) {
+	log.push(WarnLevel, reqid, msg, fields)
 }
 
 // Error logs a message at ErrorLevel.
 func (log *Logger) Error(reqid uint64, msg string) {
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = ErrorLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.push(ErrorLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Errorf(reqid uint64, format string, args ...interface{}) {
 
-	log.Error(reqid, fmt.Sprintf(format, args...))
+	log.push(ErrorLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
+
+// ErrorFields logs a message at ErrorLevel with the fields passed at the
+// log site.
+func (log *Logger) ErrorFields(reqid uint64, msg string, fields ...Field) {
+	log.push(ErrorLevel, reqid, msg, fields)
 }
 
-// Panic logs a message at PanicLevel. T
+// DPanic logs a message at DPanicLevel.
+//
+// If the Logger is in development mode (see Development), the message and
+// all the entries logged before it are written synchronously, then it panics.
+// Otherwise it's just an entry like Error.
+func (log *Logger) DPanic(reqid uint64, msg string) {
+	if log.owner().development {
+		log.writeThenExit(DPanicLevel, reqid, msg, nil)
+		return
+	}
+	log.push(DPanicLevel, reqid, msg, nil)
+}
+
+func (log *Logger) DPanicf(reqid uint64, format string, args ...interface{}) {
+	if log.owner().development {
+		log.writeThenExit(DPanicLevel, reqid, fmt.Sprintf(format, args...), nil)
+		return
+	}
+	log.push(DPanicLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
+
+// DPanicFields logs a message at DPanicLevel with the fields passed at the
+// log site. See DPanic for the development mode.
+func (log *Logger) DPanicFields(reqid uint64, msg string, fields ...Field) {
+	if log.owner().development {
+		log.writeThenExit(DPanicLevel, reqid, msg, fields)
+		return
+	}
+	log.push(DPanicLevel, reqid, msg, fields)
+}
+
+// Panic logs a message at PanicLevel. The message and all the entries logged
+// before it are written synchronously.
 //
 // The logger then panics, even if logging at PanicLevel is disabled.
 func (log *Logger) Panic(reqid uint64, msg string) {
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = PanicLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.writeThenExit(PanicLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Panicf(reqid uint64, format string, args ...interface{}) {
 
-	log.Panic(reqid, fmt.Sprintf(format, args...))
+	log.writeThenExit(PanicLevel, reqid, fmt.Sprintf(format, args...), nil)
 }
 
-// Fatal logs a message at FatalLevel.
+// PanicFields logs a message at PanicLevel with the fields passed at the
+// log site.
+//
+// The logger then panics, even if logging at PanicLevel is disabled.
+func (log *Logger) PanicFields(reqid uint64, msg string, fields ...Field) {
+	log.writeThenExit(PanicLevel, reqid, msg, fields)
+}
+
+// Fatal logs a message at FatalLevel. The message and all the entries logged
+// before it are written synchronously.
 //
 // The logger then calls os.Exit(1), even if logging at FatalLevel is
 // disabled.
 func (log *Logger) Fatal(reqid uint64, msg string) {
-	lb := getLogBody()
-	lb.msg = msg
-	lb.lvl = FatalLevel
-	lb.reqid = reqid
-
-	log.ring.Push(unsafe.Pointer(lb))
+	log.writeThenExit(FatalLevel, reqid, msg, nil)
 }
 
 func (log *Logger) Fatalf(reqid uint64, format string, args ...interface{}) {
 
-	log.Fatal(reqid, fmt.Sprintf(format, args...))
+	log.writeThenExit(FatalLevel, reqid, fmt.Sprintf(format, args...), nil)
+}
+
+// FatalFields logs a message at FatalLevel with the fields passed at the
+// log site.
+//
+// The logger then calls os.Exit(1), even if logging at FatalLevel is
+// disabled.
+func (log *Logger) FatalFields(reqid uint64, msg string, fields ...Field) {
+	log.writeThenExit(FatalLevel, reqid, msg, fields)
 }
 
 // Sync calls the underlying Core's Sync method, flushing any buffered log
@@ -225,27 +468,35 @@ func (log *Logger) Core() zapcore.Core {
 	return log.core
 }
 
-func (log *Logger) check(lvl zapcore.Level, msg string, reqid uint64) *zapcore.CheckedEntry {
+func entry(lb *logBody) zapcore.Entry {
+	ent := zapcore.Entry{
+		Time:    lb.time,
+		Level:   lb.lvl,
+		Message: lb.msg,
+		ReqID:   lb.reqid,
+	}
+	if lb.pc != 0 {
+		// Resolved here but not in the log call, it's much slower than
+		// getting the pc.
+		frame, _ := runtime.CallersFrames([]uintptr{lb.pc}).Next()
+		ent.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, frame.PC != 0)
+	}
+	if lb.stack != nil {
+		ent.Stack = lb.stack.format()
+	}
+	return ent
+}
+
+func check(lb *logBody) *zapcore.CheckedEntry {
 
 	// Create basic checked entry thru the core; this will be non-nil if the
 	// log message will actually be written somewhere.
-	ent := zapcore.Entry{
-		Time:    tsc.UnixNano(),
-		Level:   lvl,
-		Message: msg,
-		ReqID:   reqid,
-	}
-	ce := log.core.Check(ent, nil)
+	ent := entry(lb)
+	ce := lb.core.Check(ent, nil)
 	willWrite := ce != nil
 
-	// Set up any required terminal behavior.
-	switch ent.Level {
-	case zapcore.PanicLevel:
-		ce = ce.Should(ent, zapcore.WriteThenPanic)
-	case zapcore.FatalLevel:
-		ce = ce.Should(ent, zapcore.WriteThenFatal)
-
-	}
+	// Terminal behavior (Panic & Fatal) is done by Logger.writeThenExit
+	// after syncing the core, so it's not set up here.
 
 	// Only do further annotation if we're going to write this message; checked
 	// entries that exist only for terminal behavior don't benefit from
@@ -21,24 +21,33 @@
 package nanozap
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/templexxx/tsc"
 	"go.uber.org/goleak"
 
 	"github.com/zaibyte/nanozap/zapcore"
 )
 
-func withBenchedLogger(b *testing.B, f func(*Logger)) {
+func withBenchedLogger(b *testing.B, f func(*Logger), opts ...Option) {
 	logger := New(
 		zapcore.NewCore(
 			zapcore.NewJSONEncoder(defaultEncoderConf()),
 			&Discarder{},
 			DebugLevel,
-		))
-	defer logger.Close()
+		), opts...)
+	defer logger.Close(context.Background())
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -86,6 +95,26 @@ func (s *Stdouter) Write(b []byte) (int, error) {
 	return os.Stdout.Write(b)
 }
 
+// Bufferer is a WriteSyncer which collects output in memory,
+// it's safe for the background write loop and the test goroutine.
+type Bufferer struct {
+	Syncer
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *Bufferer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *Bufferer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 // default without caller and stack trace,
 func defaultEncoderConf() zapcore.EncoderConfig {
 	return zapcore.EncoderConfig{
@@ -107,15 +136,40 @@ func BenchmarkLogger_Info_Parallel(b *testing.B) {
 	})
 }
 
+func BenchmarkLogger_Info_Parallel_Ordered(b *testing.B) {
+	withBenchedLogger(b, func(log *Logger) {
+		log.Info(0, "Ten fields, passed at the log site.")
+	}, WithOrderedRing())
+}
+
+func BenchmarkLogger_InfoFields_Parallel(b *testing.B) {
+	withBenchedLogger(b, func(log *Logger) {
+		log.InfoFields(0, "Three fields, passed at the log site.",
+			String("k", "v"), Int64("n", 1), Bool("ok", true))
+	})
+}
+
 func BenchmarkLogger_Info(b *testing.B) {
+	benchmarkLoggerInfo(b)
+}
+
+func BenchmarkLogger_Info_Ordered(b *testing.B) {
+	benchmarkLoggerInfo(b, WithOrderedRing())
+}
+
+func BenchmarkLogger_Info_Caller(b *testing.B) {
+	benchmarkLoggerInfo(b, AddCaller())
+}
+
+func benchmarkLoggerInfo(b *testing.B, opts ...Option) {
 	logger := New(
 		zapcore.NewCore(
 			zapcore.NewJSONEncoder(defaultEncoderConf()),
 			&Discarder{},
 			DebugLevel,
-		))
+		), opts...)
 
-	defer logger.Close()
+	defer logger.Close(context.Background())
 
 	b.ResetTimer()
 
@@ -129,21 +183,240 @@ func TestLogger_Close(t *testing.T) {
 
 	defer goleak.VerifyNone(t)
 
+	out := &Bufferer{}
 	core := zapcore.NewCore(
 		zapcore.NewJSONEncoder(defaultEncoderConf()),
-		&Stdouter{},
+		out,
 		DebugLevel,
 	)
 
 	logger := New(core)
 
-	logger.Info(0, "logger_info")
-	logger.Info(0, "logger_info")
-	logger.Info(0, "logger_info")
-	logger.Info(0, "logger_info")
-	logger.Info(0, "logger_info")
-	logger.Info(0, "logger_info")
-	time.Sleep(2 * time.Millisecond)
+	n := 1024
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "logger_info")
+	}
+
+	assert.NoError(t, logger.Close(context.Background()))
+	assert.Equal(t, n, strings.Count(out.String(), "\n"), "Expected all pushed entries written after Close.")
+	assert.True(t, out.Called(), "Expected core synced after Close.")
+}
+
+func TestLogger_CloseDeadline(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	logger := newTestLogger(newSlowWriter(time.Millisecond), DebugLevel)
+
+	for i := 0; i < 1024; i++ {
+		logger.Info(uint64(i), "logger_info")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, logger.Close(ctx), "Expected ctx error if Close is interrupted.")
+}
+
+func TestLogger_Fields(t *testing.T) {
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+	defer logger.Close(context.Background())
+
+	fields := []Field{String("k", "v"), Int64("n", 1), Strings("ss", []string{"a", "b"})}
+	logger.InfoFields(1, "with_fields", fields...)
+	fields[0] = String("k", "changed") // Caller reuses its slice after logging.
+	logger.ErrorFields(2, "no_fields")
+
+	want := `"msg":"with_fields","reqid":1,"k":"v","n":1,"ss":["a","b"]}`
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), want)
+	}, time.Second, time.Millisecond)
+}
+
+func TestLogger_FieldsBytes(t *testing.T) {
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+
+	// Keep the background loop away until the bytes are reused.
+	logger.writeMu.Lock()
+	bin, str := []byte("abc"), []byte("def")
+	logger.InfoFields(1, "bytes", Binary("bin", bin), ByteString("str", str))
+	copy(bin, "xxx")
+	copy(str, "xxx")
+	logger.writeMu.Unlock()
+	assert.NoError(t, logger.Close(context.Background()))
+
+	assert.Contains(t, out.String(), `"bin":"YWJj","str":"def"`)
+}
+
+func TestLogger_Time(t *testing.T) {
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+
+	// Keep the background loop away for a while after logging.
+	logger.writeMu.Lock()
+	start := tsc.UnixNano()
+	logger.Info(1, "time")
+	end := tsc.UnixNano()
+	time.Sleep(20 * time.Millisecond)
+	logger.writeMu.Unlock()
+	assert.NoError(t, logger.Close(context.Background()))
+
+	var ent struct {
+		Time int64 `json:"time"`
+	}
+	assert.NoError(t, json.Unmarshal(out.buf.Bytes(), &ent))
+	assert.True(t, ent.Time >= start && ent.Time <= end,
+		"Expected the time of log call, got %d, want in [%d, %d].", ent.Time, start, end)
+}
+
+func TestLogger_With(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+
+	assert.Equal(t, logger, logger.With(), "Expected no-op With returns the same Logger.")
+
+	child := logger.With(String("tenant", "a"))
+	grandchild := child.With(Int64("shard", 1))
+	grandchild.Close(context.Background()) // Should not stop the shared loop.
+
+	child.Info(1, "child")
+	logger.Info(2, "parent")
+	grandchild.InfoFields(3, "grandchild", Bool("ok", true))
+	logger.Info(4, "parent")
+
+	wants := []string{
+		`"msg":"child","reqid":1,"tenant":"a"}`,
+		`"msg":"parent","reqid":2}`,
+		`"msg":"grandchild","reqid":3,"tenant":"a","shard":1,"ok":true}`,
+	}
+	assert.Eventually(t, func() bool {
+		s := out.String()
+		for _, want := range wants {
+			if !strings.Contains(s, want) {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	logger.Close(context.Background())
+}
+
+func TestLogger_Panic(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+	child := logger.With(String("k", "v"))
+
+	for i := 0; i < 16; i++ {
+		logger.Info(uint64(i), "before_panic")
+	}
+
+	assert.PanicsWithValue(t, "boom", func() { child.PanicFields(16, "boom", Int64("n", 1)) },
+		"Expected panic on the caller's goroutine.")
+
+	s := out.String()
+	assert.Equal(t, 17, strings.Count(s, "\n"), "Expected entries before Panic written synchronously.")
+	assert.True(t, strings.HasSuffix(s, `"msg":"boom","reqid":16,"k":"v","n":1}`+"\n"),
+		"Expected Panic entry written last.")
+	assert.True(t, out.Called(), "Expected core synced before panic.")
+
+	assert.NoError(t, logger.Close(context.Background()))
+}
+
+func TestLogger_DPanic(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel)
+
+	assert.NotPanics(t, func() { logger.DPanicf(1, "dpanic %d", 1) },
+		"Expected no panic in production.")
+	assert.NoError(t, logger.Close(context.Background()))
+	assert.Contains(t, out.String(), `"msg":"dpanic 1","reqid":1}`)
+	assert.Contains(t, out.String(), `"level":"dpanic"`)
+
+	out = &Bufferer{}
+	logger = newTestLogger(out, DebugLevel, Development())
+	child := logger.With(String("k", "v"))
+
+	assert.PanicsWithValue(t, "boom", func() { child.DPanicFields(2, "boom", Int64("n", 1)) },
+		"Expected panic in development.")
+	assert.True(t, strings.HasSuffix(out.String(), `"msg":"boom","reqid":2,"k":"v","n":1}`+"\n"),
+		"Expected DPanic entry written before panic.")
+
+	assert.NoError(t, logger.Close(context.Background()))
+}
+
+func TestLogger_Caller(t *testing.T) {
+
+	conf := defaultEncoderConf()
+	conf.CallerKey = "caller"
+	conf.EncodeCaller = zapcore.FullCallerEncoder
+
+	out := &Bufferer{}
+	logger := New(zapcore.NewCore(zapcore.NewJSONEncoder(conf), out, DebugLevel), AddCaller())
+	child := logger.With(String("k", "v"))
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Info(0, "0")
+	logger.Infof(1, "%d", 1)
+	logger.InfoFields(2, "2", Int("n", 2))
+	child.Warn(3, "3")
+	logger.Errorf(4, "%d", 4)
+	child.DPanicFields(5, "5")
+	assert.Panics(t, func() { logger.Panicf(6, "%d", 6) })
+	assert.NoError(t, logger.Close(context.Background()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 7)
+	for _, l := range lines {
+		var ent struct {
+			ReqID  int    `json:"reqid"`
+			Caller string `json:"caller"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(l), &ent))
+		want := zapcore.NewEntryCaller(0, file, line+1+ent.ReqID, true).FullPath()
+		assert.Equal(t, want, ent.Caller, "Unexpected caller of entry %d.", ent.ReqID)
+	}
+}
+
+func TestLogger_CallerSkip(t *testing.T) {
+
+	conf := defaultEncoderConf()
+	conf.CallerKey = "caller"
+	conf.EncodeCaller = zapcore.ShortCallerEncoder
+
+	out := &Bufferer{}
+	logger := New(zapcore.NewCore(zapcore.NewJSONEncoder(conf), out, DebugLevel),
+		AddCaller(), AddCallerSkip(1))
+	info := func(msg string) { logger.Info(0, msg) }
+
+	_, file, line, _ := runtime.Caller(0)
+	info("skipped")
+	assert.NoError(t, logger.Close(context.Background()))
+	want := zapcore.NewEntryCaller(0, file, line+1, true).TrimmedPath()
+	assert.Contains(t, out.String(), fmt.Sprintf(`"caller":%q`, want))
+}
+
+func TestLogger_NoCaller(t *testing.T) {
+
+	conf := defaultEncoderConf()
+	conf.CallerKey = "caller"
 
-	logger.Close()
+	out := &Bufferer{}
+	logger := New(zapcore.NewCore(zapcore.NewJSONEncoder(conf), out, DebugLevel))
+	logger.Info(0, "no_caller")
+	assert.NoError(t, logger.Close(context.Background()))
+	assert.NotContains(t, out.String(), `"caller"`, "Expected no caller without AddCaller.")
 }
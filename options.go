@@ -0,0 +1,166 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"math/bits"
+	"time"
+
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// Default options.
+const (
+	_defaultRingSize     = 1 << 12
+	_defaultBlockTimeout = 10 * time.Millisecond
+	_defaultIdleSpins    = 64
+	_defaultIdleYields   = 16
+	_defaultIdleWait     = 100 * time.Millisecond
+)
+
+// An Option configures a Logger.
+type Option interface {
+	apply(*Logger)
+}
+
+// optionFunc wraps a func so it satisfies the Option interface.
+type optionFunc func(*Logger)
+
+func (f optionFunc) apply(log *Logger) {
+	f(log)
+}
+
+// WithOverflowPolicy sets what the Logger does when its ring is full.
+// Default is OverwritePolicy.
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return optionFunc(func(log *Logger) {
+		log.overflow = p
+	})
+}
+
+// WithBlockTimeout sets how long a log call could be blocked with
+// BlockPolicy.
+// Default is 10ms.
+func WithBlockTimeout(d time.Duration) Option {
+	return optionFunc(func(log *Logger) {
+		log.blockTimeout = d
+	})
+}
+
+// WithRingSize sets the count of buckets in the ring, it will be rounded up
+// to a power of 2, and it must be in [2, 65536].
+// Default is 4096.
+func WithRingSize(size int) Option {
+	return optionFunc(func(log *Logger) {
+		log.ringSize = size
+	})
+}
+
+// ringSizeToN returns n which 2^n >= size.
+func ringSizeToN(size int) uint64 {
+	if size <= 1 {
+		return 0 // Illegal.
+	}
+	return uint64(bits.Len(uint(size - 1)))
+}
+
+// Development puts the Logger in development mode, which makes DPanic
+// panic after writing the message, instead of just logging it.
+func Development() Option {
+	return optionFunc(func(log *Logger) {
+		log.development = true
+	})
+}
+
+// AddCaller configures the Logger to annotate each message with the filename
+// and line number of its caller. It only costs getting the pc in the log call,
+// the filename and line number are resolved by the background loop.
+// The caller is encoded only if the EncoderConfig has a CallerKey.
+func AddCaller() Option {
+	return optionFunc(func(log *Logger) {
+		log.addCaller = true
+	})
+}
+
+// AddCallerSkip increases the number of callers skipped by caller annotation
+// (as enabled by the AddCaller option). When building wrappers around the
+// Logger, supplying this Option prevents the Logger from always reporting
+// the wrapper code as the caller.
+func AddCallerSkip(skip int) Option {
+	return optionFunc(func(log *Logger) {
+		log.callerSkip += skip
+	})
+}
+
+// AddStacktrace configures the Logger to record a stack trace for all messages
+// at or above a given level, e.g. AddStacktrace(ErrorLevel).
+// The stack is captured in the log call, and formatted by the background loop.
+// It's encoded only if the EncoderConfig has a StacktraceKey.
+func AddStacktrace(lvl zapcore.LevelEnabler) Option {
+	return optionFunc(func(log *Logger) {
+		log.addStack = lvl
+	})
+}
+
+// WithOrderedRing makes the Logger write entries in the order of log calls,
+// which costs a bit more than the default ring: the background loop must wait
+// for the slow log calls instead of skipping them, and the log calls
+// contend for a shared position.
+// With OverwritePolicy, the oldest entry is dropped when the ring is full.
+func WithOrderedRing() Option {
+	return optionFunc(func(log *Logger) {
+		log.ordered = true
+	})
+}
+
+// WithIdleSpins sets how the background loop waits when there is nothing to
+// write: it retries spins times at once, then retries yields times with
+// yielding the processor, at last it's parked (see WithIdleWait).
+// Default is 64 spins and 16 yields.
+func WithIdleSpins(spins, yields int) Option {
+	return optionFunc(func(log *Logger) {
+		log.idleSpins = spins
+		log.idleYields = yields
+	})
+}
+
+// WithIdleWait sets the longest time the background loop is parked when
+// there is nothing to write, it's woken up by new entries before that.
+// d <= 0 means never parking: keep yielding the processor, which provides
+// the lowest latency but costs CPU.
+// Default is 100ms.
+func WithIdleWait(d time.Duration) Option {
+	return optionFunc(func(log *Logger) {
+		log.idleWait = d
+	})
+}
+
+// WithBatch makes the background loop combine the entries popped in a row
+// into one write if their core is a zapcore.BatchCore. A batch is written
+// when it has maxEntries entries or maxBytes bytes, or the ring is empty.
+// maxEntries <= 0 disables it (the default), maxBytes <= 0 means no limit.
+func WithBatch(maxEntries, maxBytes int) Option {
+	return optionFunc(func(log *Logger) {
+		log.batch.maxEntries = maxEntries
+		log.batch.maxBytes = maxBytes
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestWithRingSize(t *testing.T) {
+	tests := []struct {
+		size   int
+		expect int
+	}{
+		{2, 2},
+		{3, 4},
+		{100, 128},
+		{4096, 4096},
+		{65536, 65536},
+	}
+	for _, tt := range tests {
+		logger := newTestLogger(&Discarder{}, DebugLevel, WithRingSize(tt.size))
+		assert.Equal(t, tt.expect, logger.ring.size(), "Unexpected ring size for %d.", tt.size)
+		logger.Close(context.Background())
+	}
+
+	for _, size := range []int{-1, 0, 1, 65537} {
+		assert.Panics(t, func() {
+			newTestLogger(&Discarder{}, DebugLevel, WithRingSize(size))
+		}, "Expected panic for illegal ring size %d.", size)
+	}
+}
+
+func TestLogger_IdleWait(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel, WithIdleWait(time.Hour))
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint32(&logger.ring.base().parked) == 1
+	}, time.Second, time.Millisecond, "Expected the idle loop parked.")
+
+	logger.Info(1, "wake_up")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "wake_up")
+	}, time.Second, time.Millisecond, "Expected the parked loop woken up by new entries.")
+
+	assert.NoError(t, logger.Close(context.Background()))
+}
+
+func TestLogger_NoPark(t *testing.T) {
+
+	defer goleak.VerifyNone(t)
+
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel, WithIdleWait(0), WithIdleSpins(0, 0))
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&logger.ring.base().parked), "Expected the loop never parked.")
+
+	logger.Info(1, "no_park")
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "no_park")
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, logger.Close(context.Background()))
+}
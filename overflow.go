@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import "fmt"
+
+// OverflowPolicy decides what to do with an entry when the ring is full
+// (the entry's bucket is still occupied by an entry not written yet).
+type OverflowPolicy uint8
+
+const (
+	// OverwritePolicy drops the oldest entry: the new one overwrites it.
+	// Log calls never block. It's the default policy.
+	OverwritePolicy OverflowPolicy = iota
+	// DropNewestPolicy drops the new entry, keeping the older ones.
+	// Log calls never block.
+	DropNewestPolicy
+	// BlockPolicy makes the log call wait for the bucket being freed,
+	// the new entry is dropped if it still can't be pushed after the
+	// block timeout (see WithBlockTimeout).
+	BlockPolicy
+	// LevelAwarePolicy sheds low-level entries first, and never drops entries
+	// at ErrorLevel and above:
+	//
+	// DebugLevel & InfoLevel entries are dropped once the ring is 3/4 full,
+	// keeping room for the others.
+	// WarnLevel entries are dropped when the ring is full.
+	// ErrorLevel and above entries wait for the bucket being freed.
+	LevelAwarePolicy
+)
+
+// String returns a lower-case ASCII representation of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverwritePolicy:
+		return "overwrite"
+	case DropNewestPolicy:
+		return "drop_newest"
+	case BlockPolicy:
+		return "block"
+	case LevelAwarePolicy:
+		return "level_aware"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", p)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverflowPolicy_String(t *testing.T) {
+	assert.Equal(t, "overwrite", OverwritePolicy.String())
+	assert.Equal(t, "drop_newest", DropNewestPolicy.String())
+	assert.Equal(t, "block", BlockPolicy.String())
+	assert.Equal(t, "level_aware", LevelAwarePolicy.String())
+	assert.Equal(t, "OverflowPolicy(10)", OverflowPolicy(10).String())
+}
+
+func TestOverwritePolicy(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel)
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "info")
+	}
+	out.open()
+
+	st := closeLogger(t, logger)
+	assert.NotZero(t, st.Overwritten.Get(InfoLevel))
+	assert.Zero(t, st.Rejected.Total())
+}
+
+func TestDropNewestPolicy(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel, WithOverflowPolicy(DropNewestPolicy))
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "info")
+	}
+	out.open()
+
+	st := closeLogger(t, logger)
+	assert.NotZero(t, st.Rejected.Get(InfoLevel))
+	assert.Zero(t, st.Overwritten.Total())
+}
+
+func TestBlockPolicy(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel, WithOverflowPolicy(BlockPolicy), WithBlockTimeout(time.Millisecond))
+	n := logger.ring.size() + 8
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "info")
+	}
+	out.open()
+
+	st := closeLogger(t, logger)
+	assert.NotZero(t, st.Rejected.Get(InfoLevel), "Expected entries rejected after timeout.")
+	assert.Zero(t, st.Overwritten.Total())
+}
+
+func TestBlockPolicy_Unblocked(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel, WithOverflowPolicy(BlockPolicy), WithBlockTimeout(time.Minute))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		out.open()
+	}()
+
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "info")
+	}
+
+	st := closeLogger(t, logger)
+	assert.Zero(t, st.Dropped(), "Expected no drops if the consumer catches up before timeout.")
+}
+
+func TestLevelAwarePolicy(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel, WithOverflowPolicy(LevelAwarePolicy))
+	size := logger.ring.size()
+
+	for i := 0; i < size; i++ {
+		logger.Debug(uint64(i), "debug")
+		logger.Info(uint64(i), "info")
+	}
+	for i := 0; i < size; i++ {
+		logger.Warn(uint64(i), "warn")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		out.open()
+	}()
+	for i := 0; i < size; i++ {
+		logger.Error(uint64(i), "error")
+	}
+
+	st := closeLogger(t, logger)
+	assert.NotZero(t, st.Rejected.Get(DebugLevel))
+	assert.NotZero(t, st.Rejected.Get(InfoLevel))
+	assert.NotZero(t, st.Rejected.Get(WarnLevel))
+	assert.Zero(t, st.Overwritten.Total())
+	assert.Zero(t, st.Rejected.Get(ErrorLevel), "Expected no ErrorLevel entries dropped.")
+	assert.Equal(t, uint64(size), st.Written.Get(ErrorLevel))
+	// +2: the one crossing the watermark & the one being written by the consumer.
+	accepted := st.Written.Get(DebugLevel) + st.Written.Get(InfoLevel)
+	assert.True(t, accepted <= uint64(size)/4*3+2,
+		"Expected DebugLevel & InfoLevel entries stopped at the watermark, got %d.", accepted)
+}
+
+// A producer delayed between taking a bucket and storing data in it mustn't
+// jam the ring: the consumer waits for it instead of skipping the bucket.
+func TestRing_DelayedStore(t *testing.T) {
+	for _, policy := range []OverflowPolicy{DropNewestPolicy, BlockPolicy, LevelAwarePolicy} {
+		t.Run(policy.String(), func(t *testing.T) {
+			r := newRandRing(3, policy, time.Millisecond)
+			size := r.size()
+
+			newBody := func(reqid uint64) unsafe.Pointer {
+				lb := getLogBody()
+				lb.lvl = WarnLevel // Not shed by LevelAwarePolicy until full.
+				lb.reqid = reqid
+				return unsafe.Pointer(lb)
+			}
+			popReqID := func() (uint64, bool) {
+				data, ok := r.TryPop()
+				if !ok {
+					return 0, false
+				}
+				lb := (*logBody)(data)
+				defer lb.free()
+				return lb.reqid, true
+			}
+
+			// Take a bucket like Push, but delay the storing.
+			slowIdx := atomic.AddUint64(&r.writeIndex, 1) & r.mask
+			for i := 1; i < size; i++ {
+				r.Push(newBody(uint64(i)))
+			}
+
+			for i := 0; i < popSpins*4; i++ {
+				_, ok := popReqID()
+				assert.False(t, ok, "Expected waiting for the delayed bucket.")
+			}
+			assert.Zero(t, r.stats.skipped, "Expected no bucket skipped.")
+
+			r.store(slowIdx, newBody(0))
+			for i := 0; i < size; i++ {
+				reqid, ok := popReqID()
+				assert.True(t, ok)
+				assert.Equal(t, uint64(i), reqid)
+			}
+
+			// The ring works as usual.
+			for i := 0; i < 100; i++ {
+				r.Push(newBody(uint64(i)))
+				reqid, ok := popReqID()
+				assert.True(t, ok)
+				assert.Equal(t, uint64(i), reqid)
+			}
+			assert.Zero(t, r.stats.rejected.load().Total(), "Expected no entry rejected.")
+			assert.Zero(t, r.stats.skipped, "Expected no bucket skipped.")
+		})
+	}
+}
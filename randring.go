@@ -21,17 +21,17 @@
 // Package randring provides a ring buckets for multi-producer & one-consumer
 // which will drop messages if buckets full and won't guarantee order.
 // randring only cares about memory corruption.
+// See SeqRing for the ordered one.
 package nanozap
 
 import (
+	"context"
+	"runtime"
 	"sync/atomic"
+	"time"
 	"unsafe"
-
-	"github.com/templexxx/cpu"
 )
 
-const falseSharingRange = cpu.X86FalseSharingRange
-
 // Ring provides a ring buckets for multi-producer & one-consumer.
 type Ring struct {
 	mask       uint64
@@ -41,57 +41,216 @@ type Ring struct {
 
 	// writeIndex cache for Pop, only get new write index when read catch write.
 	// Help to reduce caching missing.
+	// It's writeIndex+1 (the count of pushed), because writeIndex starts from ^0.
 	writeIndexCache uint64
-	readIndex       uint64
+	// readIndex is only modified by the consumer, but it's loaded by producers
+	// for checking the watermark of LevelAwarePolicy.
+	readIndex uint64
+	// lastMisses is the count of TryPop finding the last pushed bucket empty.
+	lastMisses int
 
 	buckets []unsafe.Pointer
+
+	ringBase
 }
 
 // New creates a ring.
 // ring size = 2 ^ n.
-func newRandRing(n uint64) *Ring {
+// blockTimeout is only used by BlockPolicy.
+func newRandRing(n uint64, policy OverflowPolicy, blockTimeout time.Duration) *Ring {
 
 	if n > 16 || n == 0 {
 		panic("illegal ring size")
 	}
 
 	r := &Ring{
-		buckets: make([]unsafe.Pointer, 1<<n),
-		mask:    (1 << n) - 1,
+		buckets:  make([]unsafe.Pointer, 1<<n),
+		mask:     (1 << n) - 1,
+		ringBase: newRingBase(policy, blockTimeout),
 	}
 
 	r.writeIndex = ^r.writeIndex
 	return r
 }
 
-// Push puts the data in ring in the next bucket no matter what in it.
+// Push puts the data in ring in the next bucket,
+// what to do if the bucket is occupied depends on the OverflowPolicy.
 func (r *Ring) Push(data unsafe.Pointer) {
-	idx := atomic.AddUint64(&r.writeIndex, 1) & r.mask
-	old := atomic.SwapPointer(&r.buckets[idx], data)
-	if old != nil {
-		lb := (*logBody)(old)
-		lb.free()
+	lvl := (*logBody)(data).lvl
+	r.stats.pushed.inc(data, lvl)
+
+	if r.policy == OverwritePolicy {
+		idx := atomic.AddUint64(&r.writeIndex, 1) & r.mask
+		old := atomic.SwapPointer(&r.buckets[idx], data)
+		if old != nil {
+			lb := (*logBody)(old)
+			r.stats.overwritten.inc(lb.lvl)
+			lb.free()
+		}
+		r.notify()
+		return
+	}
+
+	if r.policy == LevelAwarePolicy && lvl < WarnLevel && r.aboveWatermark() {
+		r.reject(data, lvl)
+		return
+	}
+
+	// Other policies never overwrite, so the index is taken only if
+	// the ring isn't full: the bucket has been popped in the previous round.
+	// The consumer waits for a taken bucket, so there is no hole in ring.
+	var deadline int64
+	for {
+		ri := atomic.LoadUint64(&r.readIndex) // Load it first, readIndex <= writeIndex+1.
+		wi := atomic.LoadUint64(&r.writeIndex)
+		idx := (wi + 1) & r.mask
+		if wi+1-ri <= r.mask && atomic.LoadPointer(&r.buckets[idx]) == nil {
+			if atomic.CompareAndSwapUint64(&r.writeIndex, wi, wi+1) {
+				r.store(idx, data)
+				return
+			}
+			continue // Another producer took it.
+		}
+		if !r.shouldWait(lvl, &deadline) {
+			r.reject(data, lvl)
+			return
+		}
+		runtime.Gosched()
 	}
 }
 
+// store stores data in the bucket taken by the producer.
+// The bucket is free, because the ring wasn't full when it was taken.
+func (r *Ring) store(idx uint64, data unsafe.Pointer) {
+	atomic.StorePointer(&r.buckets[idx], data)
+	r.notify()
+}
+
+func (r *Ring) size() int {
+	return len(r.buckets)
+}
+
+func (r *Ring) empty() bool {
+	return r.readIndex >= atomic.LoadUint64(&r.writeIndex)+1
+}
+
+func (r *Ring) wait(done <-chan struct{}, timer *time.Timer, d time.Duration) {
+	r.park(done, timer, d, r.empty)
+}
+
+// aboveWatermark returns true if the ring is more than 3/4 full.
+func (r *Ring) aboveWatermark() bool {
+	ri := atomic.LoadUint64(&r.readIndex) // Load it first, readIndex <= writeIndex+1.
+	used := atomic.LoadUint64(&r.writeIndex) + 1 - ri
+	return used > (r.mask+1)/4*3
+}
+
+// popSpins is the number of times the consumer waits for an empty bucket
+// before skipping it (OverwritePolicy only).
+const popSpins = 64
+
 // TryPop tries to pop data from the next bucket,
 // return (nil, false) if no data available.
+//
+// An empty bucket means the producer hasn't finished its Push yet,
+// or (OverwritePolicy only) the data in it has been overwritten and popped
+// in the previous round.
+//
+// With OverwritePolicy, TryPop waits for it a while, then skips it.
+// For the last pushed bucket, the waiting is across calls, because it's
+// common that the producer is still pushing.
+// With other policies, the bucket must be filled soon, so TryPop never skips
+// it like SeqRing: it returns (nil, false), and the data after it must wait.
 func (r *Ring) TryPop() (unsafe.Pointer, bool) {
 
-	if r.readIndex >= r.writeIndexCache {
-		r.writeIndexCache = atomic.LoadUint64(&r.writeIndex)
+	for {
 		if r.readIndex >= r.writeIndexCache {
-			return nil, false
+			r.writeIndexCache = atomic.LoadUint64(&r.writeIndex) + 1
+			if r.readIndex >= r.writeIndexCache {
+				return nil, false
+			}
+		}
+
+		if r.policy == OverwritePolicy && r.writeIndexCache-r.readIndex > r.mask+1 {
+			// Lapped by producers, older data must have been overwritten.
+			atomic.StoreUint64(&r.readIndex, r.writeIndexCache-r.mask-1)
+		}
+
+		if r.policy != OverwritePolicy {
+			return r.pop(false)
+		}
+
+		last := r.readIndex+1 == r.writeIndexCache
+		data, ok := r.pop(!last)
+		if ok {
+			r.lastMisses = 0
+			return data, true
+		}
+		if last {
+			r.lastMisses++
+			if r.lastMisses > popSpins {
+				r.lastMisses = 0
+				r.skip()
+			}
+			return nil, false // Try it later, producer is still pushing.
 		}
 	}
+}
 
+// pop pops the bucket at readIndex. If the bucket is empty,
+// it returns (nil, false) at once, or if skip is true,
+// it will be skipped after waiting popSpins times.
+func (r *Ring) pop(skip bool) (unsafe.Pointer, bool) {
 	idx := r.readIndex & r.mask
-	data := atomic.SwapPointer(&r.buckets[idx], nil)
+	for i := 0; ; i++ {
+		data := atomic.SwapPointer(&r.buckets[idx], nil)
+		if data != nil {
+			atomic.StoreUint64(&r.readIndex, r.readIndex+1)
+			r.stats.written.inc((*logBody)(data).lvl)
+			return data, true
+		}
+		if !skip {
+			return nil, false
+		}
+		if i == popSpins {
+			r.skip()
+			return nil, false
+		}
+		runtime.Gosched()
+	}
+}
+
+func (r *Ring) skip() {
+	atomic.StoreUint64(&r.readIndex, r.readIndex+1)
+	atomic.AddUint64(&r.stats.skipped, 1)
+}
 
-	if data == nil {
-		return nil, false
+// Drain pops all data pushed before calling it and passes them to fn,
+// it returns ctx.Err() if ctx is done before finishing.
+//
+// Drain must not be called concurrently with TryPop.
+func (r *Ring) Drain(ctx context.Context, fn func(unsafe.Pointer)) error {
+
+	end := atomic.LoadUint64(&r.writeIndex) + 1
+	size := r.mask + 1
+	if r.policy == OverwritePolicy && end-r.readIndex > size {
+		atomic.StoreUint64(&r.readIndex, end-size) // See TryPop.
 	}
 
-	r.readIndex++
-	return data, true
+	skip := r.policy == OverwritePolicy
+	for r.readIndex < end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// It's fine to skip the last one here, the entries pushed after
+		// calling Drain are not promised.
+		if data, ok := r.pop(skip); ok {
+			fn(data)
+			continue
+		}
+		if !skip {
+			runtime.Gosched() // The producer is still pushing.
+		}
+	}
+	return nil
 }
@@ -0,0 +1,166 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/templexxx/cpu"
+	"github.com/templexxx/tsc"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+const falseSharingRange = cpu.X86FalseSharingRange
+
+// ring is a queue of *logBody for multi-producer & one-consumer.
+// The methods of consumer side must not be called concurrently.
+type ring interface {
+	// Push puts data in ring, it's called by producers.
+	Push(data unsafe.Pointer)
+	// TryPop tries to pop data, return (nil, false) if no data available.
+	TryPop() (unsafe.Pointer, bool)
+	// Drain pops all data pushed before calling it and passes them to fn,
+	// it returns ctx.Err() if ctx is done before finishing.
+	Drain(ctx context.Context, fn func(unsafe.Pointer)) error
+	// wait parks the consumer until new data pushed, d passed or done closed.
+	wait(done <-chan struct{}, timer *time.Timer, d time.Duration)
+	// close makes Push never block.
+	close()
+
+	// size returns the count of buckets.
+	size() int
+	// base returns the states shared by all kinds of ring.
+	base() *ringBase
+}
+
+// ringBase holds the overflow policy, consumer parking & counters,
+// which are the same in all kinds of ring.
+type ringBase struct {
+	policy       OverflowPolicy
+	blockTimeout int64
+	closed       uint32 // Producers won't be blocked after closing.
+
+	// parked is 1 if the consumer is parked in wait, it's loaded by producers
+	// for each Push, but only modified when the consumer is idle.
+	_      [falseSharingRange]byte
+	parked uint32
+	wake   chan struct{}
+
+	_     [falseSharingRange]byte
+	stats ringStats
+}
+
+// blockTimeout is only used by BlockPolicy.
+func newRingBase(policy OverflowPolicy, blockTimeout time.Duration) ringBase {
+	return ringBase{
+		policy:       policy,
+		blockTimeout: int64(blockTimeout),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+func (r *ringBase) base() *ringBase {
+	return r
+}
+
+// ringStats is the counters of ring, the consumer side counters are
+// only modified by the consumer, but they are read by Logger.Stats.
+type ringStats struct {
+	pushed      shardedCounters // Counted by all producers.
+	_           [falseSharingRange]byte
+	overwritten levelCounters
+	_           [falseSharingRange]byte
+	written     levelCounters
+	skipped     uint64
+	_           [falseSharingRange]byte
+	rejected    levelCounters
+}
+
+// shouldWait returns true if the producer should wait for a free bucket.
+// deadline is the block deadline (in nanoseconds) of BlockPolicy,
+// it's set in the first calling.
+func (r *ringBase) shouldWait(lvl zapcore.Level, deadline *int64) bool {
+	if atomic.LoadUint32(&r.closed) == 1 {
+		return false
+	}
+	switch r.policy {
+	case BlockPolicy:
+		now := tsc.UnixNano()
+		if *deadline == 0 {
+			*deadline = now + r.blockTimeout
+		}
+		return now <= *deadline
+	case LevelAwarePolicy:
+		return lvl >= ErrorLevel
+	default:
+		return false
+	}
+}
+
+func (r *ringBase) reject(data unsafe.Pointer, lvl zapcore.Level) {
+	r.stats.rejected.inc(lvl)
+	(*logBody)(data).free()
+}
+
+// notify wakes up the parked consumer.
+func (r *ringBase) notify() {
+	if atomic.LoadUint32(&r.parked) == 1 && atomic.CompareAndSwapUint32(&r.parked, 1, 0) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// park parks the consumer until new data pushed, d passed or done closed.
+// timer is owned by the consumer, it must be stopped and drained.
+func (r *ringBase) park(done <-chan struct{}, timer *time.Timer, d time.Duration, empty func() bool) {
+	atomic.StoreUint32(&r.parked, 1)
+	// Check again after setting parked, the producer which pushed before it
+	// may not notify.
+	if !empty() {
+		atomic.StoreUint32(&r.parked, 0)
+		return
+	}
+
+	timer.Reset(d)
+	select {
+	case <-r.wake:
+	case <-timer.C:
+	case <-done:
+	}
+	atomic.StoreUint32(&r.parked, 0)
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+// close makes Push never block.
+func (r *ringBase) close() {
+	atomic.StoreUint32(&r.closed, 1)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// SeqRing provides an ordered ring buckets for multi-producer & one-consumer,
+// the data is popped in the order of pushing.
+//
+// It's a bounded queue of sequence-stamped cells (by Dmitry Vyukov):
+// a cell is free for the producer at position pos if its seq == pos,
+// and it's ready for the consumer if its seq == pos+1.
+// Both sides are lock-free, but the consumer must wait for a producer
+// which has taken a position and hasn't finished its Push,
+// instead of skipping it like Ring.
+type SeqRing struct {
+	mask       uint64
+	_          [falseSharingRange]byte
+	enqueuePos uint64
+	_          [falseSharingRange]byte
+	// dequeuePos is modified by the consumer, and by producers evicting
+	// the oldest data with OverwritePolicy.
+	dequeuePos uint64
+
+	cells []seqCell
+
+	ringBase
+}
+
+type seqCell struct {
+	seq  uint64
+	data unsafe.Pointer
+}
+
+// newSeqRing creates an ordered ring.
+// ring size = 2 ^ n.
+// blockTimeout is only used by BlockPolicy.
+func newSeqRing(n uint64, policy OverflowPolicy, blockTimeout time.Duration) *SeqRing {
+
+	if n > 16 || n == 0 {
+		panic("illegal ring size")
+	}
+
+	r := &SeqRing{
+		cells:    make([]seqCell, 1<<n),
+		mask:     (1 << n) - 1,
+		ringBase: newRingBase(policy, blockTimeout),
+	}
+	for i := range r.cells {
+		r.cells[i].seq = uint64(i)
+	}
+	return r
+}
+
+// Push puts the data in ring after the data pushed before,
+// what to do if ring is full depends on the OverflowPolicy.
+func (r *SeqRing) Push(data unsafe.Pointer) {
+	lvl := (*logBody)(data).lvl
+	r.stats.pushed.inc(data, lvl)
+
+	if r.policy == LevelAwarePolicy && lvl < WarnLevel && r.aboveWatermark() {
+		r.reject(data, lvl)
+		return
+	}
+
+	var deadline int64
+	for {
+		pos := atomic.LoadUint64(&r.enqueuePos)
+		c := &r.cells[pos&r.mask]
+		dif := int64(atomic.LoadUint64(&c.seq) - pos)
+		if dif == 0 {
+			if atomic.CompareAndSwapUint64(&r.enqueuePos, pos, pos+1) {
+				atomic.StorePointer(&c.data, data)
+				atomic.StoreUint64(&c.seq, pos+1)
+				r.notify()
+				return
+			}
+			continue // Another producer took it.
+		}
+		if dif > 0 {
+			continue // pos is stale.
+		}
+
+		// Full.
+		if r.policy == OverwritePolicy {
+			// Evict the oldest one, so the order is still kept.
+			if old, ok := r.dequeue(); ok {
+				lb := (*logBody)(old)
+				r.stats.overwritten.inc(lb.lvl)
+				lb.free()
+				continue
+			}
+		} else if !r.shouldWait(lvl, &deadline) {
+			r.reject(data, lvl)
+			return
+		}
+		runtime.Gosched() // The oldest one is still being pushed or popped.
+	}
+}
+
+// dequeue takes the data at dequeuePos,
+// return (nil, false) if it's not pushed yet.
+func (r *SeqRing) dequeue() (unsafe.Pointer, bool) {
+	for {
+		pos := atomic.LoadUint64(&r.dequeuePos)
+		c := &r.cells[pos&r.mask]
+		dif := int64(atomic.LoadUint64(&c.seq) - (pos + 1))
+		if dif < 0 {
+			return nil, false
+		}
+		if dif == 0 && atomic.CompareAndSwapUint64(&r.dequeuePos, pos, pos+1) {
+			data := atomic.SwapPointer(&c.data, nil)
+			atomic.StoreUint64(&c.seq, pos+r.mask+1) // Free for the next round.
+			return data, true
+		}
+		// Taken by an evicting producer, try the next one.
+	}
+}
+
+// TryPop tries to pop the oldest data,
+// return (nil, false) if no data available.
+//
+// If the producer of the oldest data hasn't finished its Push,
+// TryPop returns (nil, false) too, the data after it must wait.
+func (r *SeqRing) TryPop() (unsafe.Pointer, bool) {
+	data, ok := r.dequeue()
+	if ok {
+		r.stats.written.inc((*logBody)(data).lvl)
+	}
+	return data, ok
+}
+
+// Drain pops all data pushed before calling it and passes them to fn,
+// it returns ctx.Err() if ctx is done before finishing.
+//
+// Drain must not be called concurrently with TryPop.
+func (r *SeqRing) Drain(ctx context.Context, fn func(unsafe.Pointer)) error {
+
+	end := atomic.LoadUint64(&r.enqueuePos)
+	for atomic.LoadUint64(&r.dequeuePos) < end {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if data, ok := r.TryPop(); ok {
+			fn(data)
+			continue
+		}
+		runtime.Gosched() // The producer is still pushing.
+	}
+	return nil
+}
+
+func (r *SeqRing) size() int {
+	return len(r.cells)
+}
+
+func (r *SeqRing) empty() bool {
+	return atomic.LoadUint64(&r.dequeuePos) >= atomic.LoadUint64(&r.enqueuePos)
+}
+
+func (r *SeqRing) wait(done <-chan struct{}, timer *time.Timer, d time.Duration) {
+	r.park(done, timer, d, r.empty)
+}
+
+// aboveWatermark returns true if the ring is more than 3/4 full.
+func (r *SeqRing) aboveWatermark() bool {
+	dp := atomic.LoadUint64(&r.dequeuePos) // Load it first, dequeuePos <= enqueuePos.
+	used := atomic.LoadUint64(&r.enqueuePos) - dp
+	return used > (r.mask+1)/4*3
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderedEntry struct {
+	ReqID    uint64 `json:"reqid"`
+	Producer int    `json:"p"`
+}
+
+func decodeOrdered(t *testing.T, s string) []orderedEntry {
+	var ents []orderedEntry
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		var ent orderedEntry
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &ent), "Unexpected output: %s", sc.Text())
+		ents = append(ents, ent)
+	}
+	return ents
+}
+
+func TestSeqRing_Order(t *testing.T) {
+	out := newSlowWriter(10 * time.Microsecond)
+	logger := newTestLogger(out, DebugLevel, WithOrderedRing(), WithRingSize(8),
+		WithOverflowPolicy(BlockPolicy), WithBlockTimeout(time.Minute))
+
+	n := 256
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "ordered")
+	}
+	closeLogger(t, logger)
+
+	ents := decodeOrdered(t, out.String())
+	require.Len(t, ents, n)
+	for i, ent := range ents {
+		assert.Equal(t, uint64(i), ent.ReqID, "Unexpected order.")
+	}
+}
+
+func TestSeqRing_ProducerOrder(t *testing.T) {
+	out := newSlowWriter(10 * time.Microsecond)
+	logger := newTestLogger(out, DebugLevel, WithOrderedRing(), WithRingSize(16),
+		WithOverflowPolicy(BlockPolicy), WithBlockTimeout(time.Minute))
+
+	producers, n := 8, 128
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				logger.InfoFields(uint64(i), "ordered", Int("p", p))
+			}
+		}(p)
+	}
+	wg.Wait()
+	closeLogger(t, logger)
+
+	ents := decodeOrdered(t, out.String())
+	require.Len(t, ents, producers*n)
+	next := make([]uint64, producers)
+	for _, ent := range ents {
+		assert.Equal(t, next[ent.Producer], ent.ReqID, "Unexpected order of producer %d.", ent.Producer)
+		next[ent.Producer] = ent.ReqID + 1
+	}
+}
+
+func TestSeqRing_Overwrite(t *testing.T) {
+	out := &Bufferer{}
+	logger := newTestLogger(out, DebugLevel, WithOrderedRing(), WithRingSize(8), WithIdleWait(time.Hour),
+		WithIdleSpins(0, 0))
+
+	// Keep the background loop away until all entries pushed.
+	logger.writeMu.Lock()
+	n := 64
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "ordered")
+	}
+	logger.writeMu.Unlock()
+
+	st := closeLogger(t, logger)
+	assert.Equal(t, uint64(n-8), st.Overwritten.Get(InfoLevel))
+
+	ents := decodeOrdered(t, out.String())
+	require.Len(t, ents, 8)
+	for i, ent := range ents {
+		assert.Equal(t, uint64(n-8+i), ent.ReqID, "Expected the oldest entries overwritten.")
+	}
+}
+
+func TestSeqRing_DropNewest(t *testing.T) {
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel, WithOrderedRing(), WithOverflowPolicy(DropNewestPolicy))
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		logger.Info(uint64(i), "info")
+	}
+	out.open()
+
+	st := closeLogger(t, logger)
+	assert.NotZero(t, st.Rejected.Get(InfoLevel))
+	assert.Zero(t, st.Overwritten.Total())
+	assert.Zero(t, st.Skipped)
+}
+
+func TestSeqRing_CloseDeadline(t *testing.T) {
+	logger := newTestLogger(newSlowWriter(time.Millisecond), DebugLevel, WithOrderedRing())
+	for i := 0; i < 64; i++ {
+		logger.Info(uint64(i), "info")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, logger.Close(ctx))
+}
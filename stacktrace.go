@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/zaibyte/nanozap/internal/bufferpool"
+)
+
+const _stacktraceDepth = 64
+
+var _stacktracePool = sync.Pool{
+	New: func() interface{} {
+		return &stacktrace{pcs: make([]uintptr, _stacktraceDepth)}
+	},
+}
+
+// stacktrace holds the program counters captured in the log call,
+// they're formatted by the background loop.
+type stacktrace struct {
+	pcs []uintptr
+	n   int
+}
+
+// captureStacktrace captures the stack of the goroutine,
+// skip is the number of stack frames to skip as if runtime.Callers is called
+// by the caller of captureStacktrace.
+func captureStacktrace(skip int) *stacktrace {
+	st := _stacktracePool.Get().(*stacktrace)
+	for {
+		st.n = runtime.Callers(skip+1, st.pcs)
+		if st.n < len(st.pcs) {
+			return st
+		}
+		// Maybe truncated, try it again with a larger one.
+		st.pcs = make([]uintptr, len(st.pcs)*2)
+	}
+}
+
+// format formats the stack in the same way as zap:
+//
+//	function
+//		file:line
+func (st *stacktrace) format() string {
+	buf := bufferpool.Get()
+	defer buf.Free()
+
+	frames := runtime.CallersFrames(st.pcs[:st.n])
+	for i := 0; ; i++ {
+		frame, more := frames.Next()
+		if frame.PC == 0 {
+			break
+		}
+		if i != 0 {
+			buf.AppendByte('\n')
+		}
+		buf.AppendString(frame.Function)
+		buf.AppendByte('\n')
+		buf.AppendByte('\t')
+		buf.AppendString(frame.File)
+		buf.AppendByte(':')
+		buf.AppendInt(int64(frame.Line))
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
+
+func (st *stacktrace) free() {
+	if len(st.pcs) > _stacktraceDepth*4 {
+		return // Don't keep the huge one in pool.
+	}
+	_stacktracePool.Put(st)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func TestStacktrace(t *testing.T) {
+	st := captureStacktrace(1)
+	defer st.free()
+
+	lines := strings.Split(st.format(), "\n")
+	require.True(t, len(lines) >= 2, "Expected at least one frame.")
+	assert.Equal(t, "github.com/zaibyte/nanozap.TestStacktrace", lines[0],
+		"Expected the stack started from the caller.")
+	assert.True(t, strings.HasPrefix(lines[1], "\t"), "Expected file:line indented.")
+	assert.Contains(t, lines[1], "stacktrace_test.go:")
+	assert.Equal(t, 0, len(lines)%2, "Expected function & file:line pairs.")
+}
+
+func TestStacktrace_Deep(t *testing.T) {
+	var st *stacktrace
+	var deep func(n int)
+	deep = func(n int) {
+		if n == 0 {
+			st = captureStacktrace(1)
+			return
+		}
+		deep(n - 1)
+	}
+	deep(_stacktraceDepth * 2)
+	defer st.free()
+
+	assert.True(t, st.n > _stacktraceDepth*2, "Expected the whole stack captured.")
+}
+
+func TestLogger_Stacktrace(t *testing.T) {
+	conf := defaultEncoderConf()
+	conf.StacktraceKey = "stacktrace"
+
+	out := &Bufferer{}
+	logger := New(zapcore.NewCore(zapcore.NewJSONEncoder(conf), out, DebugLevel),
+		AddStacktrace(ErrorLevel))
+	child := logger.With(String("k", "v"))
+
+	logger.Info(0, "info")
+	child.Errorf(1, "error %d", 1)
+	assert.Panics(t, func() { logger.Panic(2, "panic") })
+	assert.NoError(t, logger.Close(context.Background()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	for i, l := range lines {
+		var ent struct {
+			Stacktrace string `json:"stacktrace"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(l), &ent))
+		if i == 0 {
+			assert.Empty(t, ent.Stacktrace, "Expected no stacktrace below ErrorLevel.")
+			continue
+		}
+		assert.True(t, strings.HasPrefix(ent.Stacktrace, "github.com/zaibyte/nanozap.TestLogger_Stacktrace"),
+			"Expected stacktrace started from the log site, got: %s.", ent.Stacktrace)
+	}
+}
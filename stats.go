@@ -0,0 +1,200 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/templexxx/tsc"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// _numLevels is the count of levels from DebugLevel to FatalLevel.
+const _numLevels = int(FatalLevel-DebugLevel) + 1
+
+// levelCounters is a counter for each level.
+type levelCounters [_numLevels]uint64
+
+func (c *levelCounters) inc(lvl zapcore.Level) {
+	atomic.AddUint64(&c[lvl-DebugLevel], 1)
+}
+
+func (c *levelCounters) load() LevelCounts {
+	var lc LevelCounts
+	for i := range c {
+		lc[i] = atomic.LoadUint64(&c[i])
+	}
+	return lc
+}
+
+// _counterShardsBits is log2 of the count of shards of shardedCounters.
+const _counterShardsBits = 4
+
+// shardedCounters is levelCounters counted by all producers. Each producer
+// counts in the shard picked by its logBody's address, pooled bodies are
+// spread over Ps, so the producers hardly contend for one cache line.
+type shardedCounters [1 << _counterShardsBits]struct {
+	levelCounters
+	_ [falseSharingRange - unsafe.Sizeof(levelCounters{})]byte
+}
+
+func (c *shardedCounters) inc(lb unsafe.Pointer, lvl zapcore.Level) {
+	// Fibonacci hashing, the low bits of an address are always 0.
+	i := (uint64(uintptr(lb)) * 0x9E3779B97F4A7C15) >> (64 - _counterShardsBits)
+	c[i].inc(lvl)
+}
+
+func (c *shardedCounters) load() LevelCounts {
+	var lc LevelCounts
+	for i := range c {
+		for j, n := range c[i].load() {
+			lc[j] += n
+		}
+	}
+	return lc
+}
+
+// LevelCounts holds a count for each level.
+type LevelCounts [_numLevels]uint64
+
+// Get returns the count of lvl.
+func (c LevelCounts) Get(lvl zapcore.Level) uint64 {
+	if lvl < DebugLevel || lvl > FatalLevel {
+		return 0
+	}
+	return c[lvl-DebugLevel]
+}
+
+// Total returns the sum of all levels.
+func (c LevelCounts) Total() uint64 {
+	var n uint64
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// Stats is a snapshot of the Logger's ring counters,
+// it's shared by a Logger and all its children.
+type Stats struct {
+	// Pushed is the count of entries pushed into the ring.
+	Pushed LevelCounts
+	// Written is the count of entries popped from the ring and passed to the core.
+	Written LevelCounts
+	// Overwritten is the count of entries dropped because the ring was full
+	// and they were overwritten by the newer ones.
+	Overwritten LevelCounts
+	// Rejected is the count of new entries dropped by the OverflowPolicy
+	// without entering the ring.
+	Rejected LevelCounts
+	// Skipped is the count of empty buckets skipped by the background loop.
+	// An empty bucket's level is unknown, so there is only a total.
+	//
+	// Only the ring with OverwritePolicy skips: the entry in the bucket has
+	// been overwritten (and counted), or its producer is slow and the entry
+	// will be written or overwritten in the next round, so skipping doesn't
+	// lose data. With other policies and the ordered ring, the background loop
+	// waits for the slow producer instead, and it's always 0.
+	Skipped uint64
+}
+
+// Dropped returns the count of entries which won't be written.
+func (s Stats) Dropped() uint64 {
+	return s.Overwritten.Total() + s.Rejected.Total()
+}
+
+// Stats returns a snapshot of the counters.
+func (log *Logger) Stats() Stats {
+	rs := &log.ring.base().stats
+	return Stats{
+		Pushed:      rs.pushed.load(),
+		Written:     rs.written.load(),
+		Overwritten: rs.overwritten.load(),
+		Rejected:    rs.rejected.load(),
+		Skipped:     atomic.LoadUint64(&rs.skipped),
+	}
+}
+
+// ReportDrops makes the background loop write a WarnLevel entry every
+// interval if there are entries dropped in the interval, so drops are visible
+// in the log itself. interval <= 0 disables it (the default).
+//
+// It's only available for the Logger created by New.
+func (log *Logger) ReportDrops(interval time.Duration) {
+	atomic.StoreInt64(&log.owner().dropReport.interval, int64(interval))
+}
+
+// dropReport is the state of ReportDrops, it's only used by the consumer
+// except interval.
+type dropReport struct {
+	interval int64
+	last     int64 // Last report time.
+	reported LevelCounts
+}
+
+// reportDrops writes the drop report entry if it's time to do it,
+// it must be called with writeMu held.
+func (log *Logger) reportDrops() {
+	interval := atomic.LoadInt64(&log.dropReport.interval)
+	if interval <= 0 {
+		return
+	}
+	now := tsc.UnixNano()
+	if now-log.dropReport.last < interval {
+		return
+	}
+	log.dropReport.last = now
+
+	dropped := log.ring.base().stats.overwritten.load()
+	rejected := log.ring.base().stats.rejected.load()
+	for i := range dropped {
+		dropped[i] += rejected[i]
+	}
+	if dropped == log.dropReport.reported {
+		return
+	}
+
+	// The first one is the total, the others are the levels which have drops.
+	fields := make([]Field, 1, _numLevels+1)
+	var total uint64
+	for i := range dropped {
+		n := dropped[i] - log.dropReport.reported[i]
+		if n == 0 {
+			continue
+		}
+		total += n
+		fields = append(fields, Uint64((zapcore.Level(i)+DebugLevel).String(), n))
+	}
+	fields[0] = Uint64("dropped", total)
+	log.dropReport.reported = dropped
+
+	ent := zapcore.Entry{
+		Time:    now,
+		Level:   WarnLevel,
+		Message: "nanozap: messages dropped",
+	}
+	if ce := log.core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+}
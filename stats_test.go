@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package nanozap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelCounts(t *testing.T) {
+	var c levelCounters
+	c.inc(DebugLevel)
+	c.inc(ErrorLevel)
+	c.inc(ErrorLevel)
+	c.inc(FatalLevel)
+
+	lc := c.load()
+	assert.Equal(t, uint64(1), lc.Get(DebugLevel))
+	assert.Equal(t, uint64(0), lc.Get(InfoLevel))
+	assert.Equal(t, uint64(2), lc.Get(ErrorLevel))
+	assert.Equal(t, uint64(1), lc.Get(FatalLevel))
+	assert.Equal(t, uint64(0), lc.Get(FatalLevel+1), "Expected 0 for unknown level.")
+	assert.Equal(t, uint64(4), lc.Total())
+}
+
+func TestLogger_Stats(t *testing.T) {
+
+	out := newGatedWriter()
+	logger := newTestLogger(out, DebugLevel)
+	child := logger.With(String("k", "v"))
+
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		child.Info(uint64(i), "info")
+	}
+	logger.Error(0, "error")
+	out.open()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(t, logger.Close(ctx))
+
+	st := logger.Stats()
+	assert.Equal(t, st, child.Stats(), "Expected stats shared with children.")
+	assert.Equal(t, uint64(n), st.Pushed.Get(InfoLevel))
+	assert.Equal(t, uint64(1), st.Pushed.Get(ErrorLevel))
+	assert.NotZero(t, st.Dropped(), "Expected entries overwritten.")
+	assert.Equal(t, st.Overwritten.Total(), st.Dropped())
+	assert.Equal(t, st.Pushed.Total(), st.Written.Total()+st.Dropped(),
+		"Expected every pushed entry to be written or overwritten.")
+}
+
+func TestLogger_ReportDrops(t *testing.T) {
+
+	out := newSlowWriter(10 * time.Microsecond)
+	logger := newTestLogger(out, DebugLevel)
+	logger.ReportDrops(time.Nanosecond)
+
+	n := logger.ring.size() * 2
+	for i := 0; i < n; i++ {
+		logger.Debug(uint64(i), "debug")
+	}
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), `"level":"warn"`)
+	}, 5*time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger.Close(ctx)
+
+	var report string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.Contains(line, `"level":"warn"`) {
+			report = line
+			break
+		}
+	}
+	assert.Contains(t, report, `"msg":"nanozap: messages dropped","reqid":0,"dropped":`)
+	assert.Contains(t, report, `"debug":`)
+	assert.NotContains(t, report, `"info":`, "Expected only levels with drops reported.")
+}
@@ -0,0 +1,429 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapbin provides a compact binary zapcore.Encoder and the Reader
+// decoding its output, it's much cheaper than JSON for the writer.
+//
+// Each entry is a record, which is the length of its body (uvarint) and the
+// body:
+//
+//	body   = version flags [time] [level] [reqid] [caller] [msg] [stack] value*
+//	value  = tag [key] payload
+//
+// flags is a bit set of the optional parts, which depend on the keys in
+// EncoderConfig. time is a varint of unix nanoseconds, level is a byte,
+// reqid is a uvarint, caller is a string and a uvarint line.
+// A string is its length (uvarint) and the bytes.
+//
+// The values at the top level and in objects have keys, the values in arrays
+// don't. Arrays and objects end with tagEnd, a namespace has no payload:
+// the values after it (in the same object) belong to it.
+// Integers are varints, floats are little-endian IEEE 754,
+// reflected values are JSON.
+package zapbin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zaibyte/nanozap/buffer"
+	"github.com/zaibyte/nanozap/internal/bufferpool"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+const version = 1
+
+// Flags of the optional parts in body.
+const (
+	flagTime = 1 << iota
+	flagLevel
+	flagReqID
+	flagCaller
+	flagMessage
+	flagStack
+)
+
+// Tags of values.
+const (
+	tagEnd byte = iota
+	tagBool
+	tagInt
+	tagUint
+	tagFloat64
+	tagFloat32
+	tagComplex128
+	tagComplex64
+	tagString
+	tagByteString
+	tagBinary
+	tagDuration
+	tagTime
+	tagReflected
+	tagArray
+	tagObject
+	tagNamespace
+)
+
+var _encoderPool = sync.Pool{New: func() interface{} {
+	return &encoder{}
+}}
+
+func getEncoder() *encoder {
+	return _encoderPool.Get().(*encoder)
+}
+
+func putEncoder(enc *encoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	_encoderPool.Put(enc)
+}
+
+type encoder struct {
+	*zapcore.EncoderConfig
+	buf     *buffer.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// NewEncoder creates a binary encoder.
+//
+// Only the keys in cfg are used: the part of entry is omitted if its key is
+// empty, but the names of keys aren't written. Values are written as they are,
+// so the time, level, duration & caller encoders are ignored.
+func NewEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &encoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+	}
+}
+
+func (enc *encoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	enc.addKey(tagArray, key)
+	return enc.appendArray(arr)
+}
+
+func (enc *encoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	enc.addKey(tagObject, key)
+	return enc.appendObject(obj)
+}
+
+func (enc *encoder) AddBinary(key string, val []byte) {
+	enc.addKey(tagBinary, key)
+	enc.appendBytes(val)
+}
+
+func (enc *encoder) AddByteString(key string, val []byte) {
+	enc.addKey(tagByteString, key)
+	enc.appendBytes(val)
+}
+
+func (enc *encoder) AddBool(key string, val bool) {
+	enc.addKey(tagBool, key)
+	enc.appendBool(val)
+}
+
+func (enc *encoder) AddComplex128(key string, val complex128) {
+	enc.addKey(tagComplex128, key)
+	enc.appendFloat64(real(val))
+	enc.appendFloat64(imag(val))
+}
+
+func (enc *encoder) AddComplex64(key string, val complex64) {
+	enc.addKey(tagComplex64, key)
+	enc.appendFloat32(real(val))
+	enc.appendFloat32(imag(val))
+}
+
+func (enc *encoder) AddDuration(key string, val time.Duration) {
+	enc.addKey(tagDuration, key)
+	enc.appendVarint(int64(val))
+}
+
+func (enc *encoder) AddFloat64(key string, val float64) {
+	enc.addKey(tagFloat64, key)
+	enc.appendFloat64(val)
+}
+
+func (enc *encoder) AddFloat32(key string, val float32) {
+	enc.addKey(tagFloat32, key)
+	enc.appendFloat32(val)
+}
+
+func (enc *encoder) AddInt64(key string, val int64) {
+	enc.addKey(tagInt, key)
+	enc.appendVarint(val)
+}
+
+func (enc *encoder) AddReflected(key string, obj interface{}) error {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	enc.addKey(tagReflected, key)
+	enc.appendBytes(b)
+	return nil
+}
+
+func (enc *encoder) OpenNamespace(key string) {
+	enc.addKey(tagNamespace, key)
+}
+
+func (enc *encoder) AddString(key, val string) {
+	enc.addKey(tagString, key)
+	enc.appendString(val)
+}
+
+func (enc *encoder) AddTime(key string, val int64) {
+	enc.addKey(tagTime, key)
+	enc.appendVarint(val)
+}
+
+func (enc *encoder) AddUint64(key string, val uint64) {
+	enc.addKey(tagUint, key)
+	enc.appendUvarint(val)
+}
+
+func (enc *encoder) AddInt(k string, v int)         { enc.AddInt64(k, int64(v)) }
+func (enc *encoder) AddInt32(k string, v int32)     { enc.AddInt64(k, int64(v)) }
+func (enc *encoder) AddInt16(k string, v int16)     { enc.AddInt64(k, int64(v)) }
+func (enc *encoder) AddInt8(k string, v int8)       { enc.AddInt64(k, int64(v)) }
+func (enc *encoder) AddUint(k string, v uint)       { enc.AddUint64(k, uint64(v)) }
+func (enc *encoder) AddUint32(k string, v uint32)   { enc.AddUint64(k, uint64(v)) }
+func (enc *encoder) AddUint16(k string, v uint16)   { enc.AddUint64(k, uint64(v)) }
+func (enc *encoder) AddUint8(k string, v uint8)     { enc.AddUint64(k, uint64(v)) }
+func (enc *encoder) AddUintptr(k string, v uintptr) { enc.AddUint64(k, uint64(v)) }
+
+func (enc *encoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	enc.buf.AppendByte(tagArray)
+	return enc.appendArray(arr)
+}
+
+func (enc *encoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	enc.buf.AppendByte(tagObject)
+	return enc.appendObject(obj)
+}
+
+func (enc *encoder) AppendReflected(val interface{}) error {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	enc.buf.AppendByte(tagReflected)
+	enc.appendBytes(b)
+	return nil
+}
+
+func (enc *encoder) AppendBool(val bool) {
+	enc.buf.AppendByte(tagBool)
+	enc.appendBool(val)
+}
+
+func (enc *encoder) AppendByteString(val []byte) {
+	enc.buf.AppendByte(tagByteString)
+	enc.appendBytes(val)
+}
+
+func (enc *encoder) AppendComplex128(val complex128) {
+	enc.buf.AppendByte(tagComplex128)
+	enc.appendFloat64(real(val))
+	enc.appendFloat64(imag(val))
+}
+
+func (enc *encoder) AppendComplex64(val complex64) {
+	enc.buf.AppendByte(tagComplex64)
+	enc.appendFloat32(real(val))
+	enc.appendFloat32(imag(val))
+}
+
+func (enc *encoder) AppendDuration(val time.Duration) {
+	enc.buf.AppendByte(tagDuration)
+	enc.appendVarint(int64(val))
+}
+
+func (enc *encoder) AppendFloat64(val float64) {
+	enc.buf.AppendByte(tagFloat64)
+	enc.appendFloat64(val)
+}
+
+func (enc *encoder) AppendFloat32(val float32) {
+	enc.buf.AppendByte(tagFloat32)
+	enc.appendFloat32(val)
+}
+
+func (enc *encoder) AppendInt64(val int64) {
+	enc.buf.AppendByte(tagInt)
+	enc.appendVarint(val)
+}
+
+func (enc *encoder) AppendString(val string) {
+	enc.buf.AppendByte(tagString)
+	enc.appendString(val)
+}
+
+func (enc *encoder) AppendTime(val int64) {
+	enc.buf.AppendByte(tagTime)
+	enc.appendVarint(val)
+}
+
+func (enc *encoder) AppendUint64(val uint64) {
+	enc.buf.AppendByte(tagUint)
+	enc.appendUvarint(val)
+}
+
+func (enc *encoder) AppendInt(v int)         { enc.AppendInt64(int64(v)) }
+func (enc *encoder) AppendInt32(v int32)     { enc.AppendInt64(int64(v)) }
+func (enc *encoder) AppendInt16(v int16)     { enc.AppendInt64(int64(v)) }
+func (enc *encoder) AppendInt8(v int8)       { enc.AppendInt64(int64(v)) }
+func (enc *encoder) AppendUint(v uint)       { enc.AppendUint64(uint64(v)) }
+func (enc *encoder) AppendUint32(v uint32)   { enc.AppendUint64(uint64(v)) }
+func (enc *encoder) AppendUint16(v uint16)   { enc.AppendUint64(uint64(v)) }
+func (enc *encoder) AppendUint8(v uint8)     { enc.AppendUint64(uint64(v)) }
+func (enc *encoder) AppendUintptr(v uintptr) { enc.AppendUint64(uint64(v)) }
+
+func (enc *encoder) Clone() zapcore.Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *encoder) clone() *encoder {
+	clone := getEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.buf = bufferpool.Get()
+	return clone
+}
+
+func (enc *encoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+
+	var flags byte
+	if final.TimeKey != "" {
+		flags |= flagTime
+	}
+	if final.LevelKey != "" {
+		flags |= flagLevel
+	}
+	if final.ReqIDKey != "" {
+		flags |= flagReqID
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		flags |= flagCaller
+	}
+	if final.MessageKey != "" {
+		flags |= flagMessage
+	}
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		flags |= flagStack
+	}
+	final.buf.AppendByte(version)
+	final.buf.AppendByte(flags)
+	if flags&flagTime != 0 {
+		final.appendVarint(ent.Time)
+	}
+	if flags&flagLevel != 0 {
+		final.buf.AppendByte(byte(ent.Level))
+	}
+	if flags&flagReqID != 0 {
+		final.appendUvarint(ent.ReqID)
+	}
+	if flags&flagCaller != 0 {
+		final.appendString(ent.Caller.File)
+		final.appendUvarint(uint64(ent.Caller.Line))
+	}
+	if flags&flagMessage != 0 {
+		final.appendString(ent.Message)
+	}
+	if flags&flagStack != 0 {
+		final.appendString(ent.Stack)
+	}
+
+	final.buf.Write(enc.buf.Bytes())
+	for i := range fields {
+		fields[i].AddTo(final)
+	}
+
+	// Prefix the body with its length.
+	ret := bufferpool.Get()
+	n := binary.PutUvarint(final.scratch[:], uint64(final.buf.Len()))
+	ret.Write(final.scratch[:n])
+	ret.Write(final.buf.Bytes())
+
+	final.buf.Free()
+	putEncoder(final)
+	return ret, nil
+}
+
+func (enc *encoder) addKey(tag byte, key string) {
+	enc.buf.AppendByte(tag)
+	enc.appendString(key)
+}
+
+func (enc *encoder) appendArray(arr zapcore.ArrayMarshaler) error {
+	err := arr.MarshalLogArray(enc)
+	enc.buf.AppendByte(tagEnd)
+	return err
+}
+
+func (enc *encoder) appendObject(obj zapcore.ObjectMarshaler) error {
+	err := obj.MarshalLogObject(enc)
+	enc.buf.AppendByte(tagEnd)
+	return err
+}
+
+func (enc *encoder) appendBool(val bool) {
+	if val {
+		enc.buf.AppendByte(1)
+		return
+	}
+	enc.buf.AppendByte(0)
+}
+
+func (enc *encoder) appendVarint(v int64) {
+	n := binary.PutVarint(enc.scratch[:], v)
+	enc.buf.Write(enc.scratch[:n])
+}
+
+func (enc *encoder) appendUvarint(v uint64) {
+	n := binary.PutUvarint(enc.scratch[:], v)
+	enc.buf.Write(enc.scratch[:n])
+}
+
+func (enc *encoder) appendFloat64(v float64) {
+	binary.LittleEndian.PutUint64(enc.scratch[:8], math.Float64bits(v))
+	enc.buf.Write(enc.scratch[:8])
+}
+
+func (enc *encoder) appendFloat32(v float32) {
+	binary.LittleEndian.PutUint32(enc.scratch[:4], math.Float32bits(v))
+	enc.buf.Write(enc.scratch[:4])
+}
+
+func (enc *encoder) appendString(s string) {
+	enc.appendUvarint(uint64(len(s)))
+	enc.buf.AppendString(s)
+}
+
+func (enc *encoder) appendBytes(b []byte) {
+	enc.appendUvarint(uint64(len(b)))
+	enc.buf.Write(b)
+}
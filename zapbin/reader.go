@@ -0,0 +1,370 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapbin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// ErrCorrupted is returned when a record can't be decoded.
+var ErrCorrupted = errors.New("zapbin: corrupted record")
+
+// _maxRecordSize is the biggest record Reader accepts,
+// avoiding a huge allocation for a corrupted length.
+const _maxRecordSize = 64 << 20
+
+// Reader reads the records written by the binary encoder.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a Reader reading records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next reads the next record and decodes it.
+// It returns io.EOF if there is no more record,
+// and io.ErrUnexpectedEOF if the last record is truncated.
+func (r *Reader) Next() (zapcore.Entry, []zapcore.Field, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return zapcore.Entry{}, nil, err
+	}
+	if n > _maxRecordSize {
+		return zapcore.Entry{}, nil, ErrCorrupted
+	}
+	if uint64(cap(r.buf)) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	if _, err = io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return zapcore.Entry{}, nil, err
+	}
+	return Decode(r.buf)
+}
+
+// Convert reads the records from src, and writes them to dst in the format of
+// enc. It's used for converting binary logs to JSON.
+func Convert(dst io.Writer, src io.Reader, enc zapcore.Encoder) error {
+	r := NewReader(src)
+	for {
+		ent, fields, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf, err := enc.EncodeEntry(ent, fields)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(buf.Bytes())
+		buf.Free()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Decode decodes the body of a record (without the length prefix).
+//
+// The parts omitted by the encoder are zero in the returned Entry.
+// The fields could be added to any zapcore.Encoder, the integers are decoded
+// as int64 or uint64, objects & arrays as marshalers, reflected values as
+// json.RawMessage. They don't reference body.
+func Decode(body []byte) (zapcore.Entry, []zapcore.Field, error) {
+	d := decoder{b: body}
+	var ent zapcore.Entry
+
+	if v := d.byte(); d.err == nil && v != version {
+		return ent, nil, fmt.Errorf("zapbin: unsupported version: %d", v)
+	}
+	flags := d.byte()
+	if flags&flagTime != 0 {
+		ent.Time = d.varint()
+	}
+	if flags&flagLevel != 0 {
+		ent.Level = zapcore.Level(int8(d.byte()))
+	}
+	if flags&flagReqID != 0 {
+		ent.ReqID = d.uvarint()
+	}
+	if flags&flagCaller != 0 {
+		file := d.string()
+		line := d.uvarint()
+		ent.Caller = zapcore.NewEntryCaller(0, file, int(line), true)
+	}
+	if flags&flagMessage != 0 {
+		ent.Message = d.string()
+	}
+	if flags&flagStack != 0 {
+		ent.Stack = d.string()
+	}
+
+	fields := d.fields(true, false)
+	if d.err != nil {
+		return zapcore.Entry{}, nil, d.err
+	}
+	return ent, fields, nil
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+// fields decodes values until tagEnd if nested, or the end of body.
+// The values have keys if keyed.
+func (d *decoder) fields(keyed, nested bool) []zapcore.Field {
+	var fs []zapcore.Field
+	for d.err == nil {
+		if len(d.b) == 0 {
+			if nested {
+				d.err = ErrCorrupted
+			}
+			return fs
+		}
+		tag := d.byte()
+		if tag == tagEnd {
+			if !nested {
+				d.err = ErrCorrupted
+			}
+			return fs
+		}
+		var key string
+		if keyed {
+			key = d.string()
+		} else if tag == tagNamespace {
+			d.err = ErrCorrupted // No namespace in array.
+			return fs
+		}
+		fs = append(fs, d.value(tag, key))
+	}
+	return fs
+}
+
+func (d *decoder) value(tag byte, key string) zapcore.Field {
+	f := zapcore.Field{Key: key}
+	switch tag {
+	case tagBool:
+		f.Type = zapcore.BoolType
+		if d.byte() == 1 {
+			f.Integer = 1
+		}
+	case tagInt:
+		f.Type = zapcore.Int64Type
+		f.Integer = d.varint()
+	case tagUint:
+		f.Type = zapcore.Uint64Type
+		f.Integer = int64(d.uvarint())
+	case tagFloat64:
+		f.Type = zapcore.Float64Type
+		f.Integer = int64(math.Float64bits(d.float64()))
+	case tagFloat32:
+		f.Type = zapcore.Float32Type
+		f.Integer = int64(math.Float32bits(d.float32()))
+	case tagComplex128:
+		f.Type = zapcore.Complex128Type
+		r := d.float64()
+		f.Interface = complex(r, d.float64())
+	case tagComplex64:
+		f.Type = zapcore.Complex64Type
+		r := d.float32()
+		f.Interface = complex(r, d.float32())
+	case tagString:
+		f.Type = zapcore.StringType
+		f.String = d.string()
+	case tagByteString:
+		f.Type = zapcore.ByteStringType
+		f.Interface = d.bytes()
+	case tagBinary:
+		f.Type = zapcore.BinaryType
+		f.Interface = d.bytes()
+	case tagDuration:
+		f.Type = zapcore.DurationType
+		f.Integer = d.varint()
+	case tagTime:
+		f.Type = zapcore.TimeType
+		f.Integer = d.varint()
+	case tagReflected:
+		f.Type = zapcore.ReflectType
+		f.Interface = json.RawMessage(d.bytes())
+	case tagArray:
+		f.Type = zapcore.ArrayMarshalerType
+		f.Interface = array(d.fields(false, true))
+	case tagObject:
+		f.Type = zapcore.ObjectMarshalerType
+		f.Interface = object(d.fields(true, true))
+	case tagNamespace:
+		f.Type = zapcore.NamespaceType
+	default:
+		d.err = ErrCorrupted
+	}
+	return f
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = ErrCorrupted
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = ErrCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = ErrCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) float64() float64 {
+	if b := d.next(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) float32() float32 {
+	if b := d.next(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+// bytes returns a copy of the next bytes.
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = ErrCorrupted
+		return nil
+	}
+	return append([]byte(nil), d.next(int(n))...)
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = ErrCorrupted
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// object replays the decoded fields of an object.
+type object []zapcore.Field
+
+func (o object) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for i := range o {
+		o[i].AddTo(enc)
+	}
+	return nil
+}
+
+// array replays the decoded values of an array.
+type array []zapcore.Field
+
+func (a array) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, f := range a {
+		var err error
+		switch f.Type {
+		case zapcore.BoolType:
+			enc.AppendBool(f.Integer == 1)
+		case zapcore.Int64Type:
+			enc.AppendInt64(f.Integer)
+		case zapcore.Uint64Type:
+			enc.AppendUint64(uint64(f.Integer))
+		case zapcore.Float64Type:
+			enc.AppendFloat64(math.Float64frombits(uint64(f.Integer)))
+		case zapcore.Float32Type:
+			enc.AppendFloat32(math.Float32frombits(uint32(f.Integer)))
+		case zapcore.Complex128Type:
+			enc.AppendComplex128(f.Interface.(complex128))
+		case zapcore.Complex64Type:
+			enc.AppendComplex64(f.Interface.(complex64))
+		case zapcore.StringType:
+			enc.AppendString(f.String)
+		case zapcore.ByteStringType:
+			enc.AppendByteString(f.Interface.([]byte))
+		case zapcore.DurationType:
+			enc.AppendDuration(time.Duration(f.Integer))
+		case zapcore.TimeType:
+			enc.AppendTime(f.Integer)
+		case zapcore.ReflectType:
+			err = enc.AppendReflected(f.Interface)
+		case zapcore.ArrayMarshalerType:
+			err = enc.AppendArray(f.Interface.(zapcore.ArrayMarshaler))
+		case zapcore.ObjectMarshalerType:
+			err = enc.AppendObject(f.Interface.(zapcore.ObjectMarshaler))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapbin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+
+	"github.com/zaibyte/nanozap"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func testEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		ReqIDKey:       "reqid",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.EpochNanosTimeEncoder,
+		EncodeDuration: zapcore.NanosDurationEncoder,
+		EncodeCaller:   zapcore.FullCallerEncoder,
+	}
+}
+
+type user struct {
+	name string
+	tags []string
+}
+
+func (u user) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("name", u.name)
+	return enc.AddArray("tags", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+		for _, t := range u.tags {
+			arr.AppendString(t)
+		}
+		return nil
+	}))
+}
+
+type users []user
+
+func (us users) MarshalLogArray(arr zapcore.ArrayEncoder) error {
+	for _, u := range us {
+		if err := arr.AppendObject(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func allFields() []zapcore.Field {
+	return []zapcore.Field{
+		nanozap.Bool("bool", true),
+		nanozap.Int("int", -1),
+		nanozap.Int8("int8", math.MinInt8),
+		nanozap.Uint64("uint64", math.MaxUint64),
+		nanozap.Uintptr("uintptr", 0xdead),
+		nanozap.Float64("float64", 1.5),
+		nanozap.Float64("nan", math.NaN()),
+		nanozap.Float32("float32", 0.1),
+		nanozap.Complex128("complex128", complex(1, -2)),
+		nanozap.Complex64("complex64", complex(0.1, 2)),
+		nanozap.String("string", "a \"quoted\" string\n"),
+		nanozap.ByteString("bytestring", []byte("bytes")),
+		nanozap.Binary("binary", []byte{0, 1, 2}),
+		nanozap.Duration("duration", time.Second),
+		nanozap.Time("time", time.Unix(1, 2).UnixNano()),
+		nanozap.Reflect("reflect", map[string]int{"a": 1}),
+		nanozap.Stringer("stringer", time.Minute),
+		nanozap.NamedError("error", errors.New("boom")),
+		nanozap.NamedError("errors", multierr.Combine(errors.New("a"), errors.New("b"))),
+		nanozap.Ints("ints", []int{1, 2, 3}),
+		nanozap.Durations("durations", []time.Duration{time.Millisecond}),
+		nanozap.Object("user", user{name: "jane", tags: []string{"x", "y"}}),
+		nanozap.Array("users", users{{name: "a"}, {name: "b", tags: []string{"z"}}}),
+		nanozap.Namespace("ns"),
+		nanozap.String("in_ns", "v"),
+	}
+}
+
+func testEntry() zapcore.Entry {
+	return zapcore.Entry{
+		Level:   zapcore.WarnLevel,
+		Time:    1234567890,
+		Message: "hello",
+		ReqID:   42,
+		Caller:  zapcore.NewEntryCaller(1, "/a/b/c.go", 10, true),
+		Stack:   "main.main\n\t/a/b/c.go:10",
+	}
+}
+
+// roundTrip encodes ent & fields by binary encoder, then decodes them.
+func roundTrip(t *testing.T, enc zapcore.Encoder, ent zapcore.Entry, fields []zapcore.Field) (zapcore.Entry, []zapcore.Field) {
+	buf, err := enc.EncodeEntry(ent, fields)
+	require.NoError(t, err)
+	defer buf.Free()
+
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	ent2, fields2, err := r.Next()
+	require.NoError(t, err)
+	_, _, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	return ent2, fields2
+}
+
+func encodeJSON(t *testing.T, enc zapcore.Encoder, ent zapcore.Entry, fields []zapcore.Field) string {
+	buf, err := enc.EncodeEntry(ent, fields)
+	require.NoError(t, err)
+	defer buf.Free()
+	return buf.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	cfg := testEncoderConfig()
+	ent := testEntry()
+
+	ent2, fields := roundTrip(t, NewEncoder(cfg), ent, allFields())
+	assert.Equal(t, ent.Level, ent2.Level)
+	assert.Equal(t, ent.Time, ent2.Time)
+	assert.Equal(t, ent.Message, ent2.Message)
+	assert.Equal(t, ent.ReqID, ent2.ReqID)
+	assert.Equal(t, ent.Caller.FullPath(), ent2.Caller.FullPath())
+	assert.Equal(t, ent.Stack, ent2.Stack)
+
+	jsonEnc := zapcore.NewJSONEncoder(cfg)
+	assert.Equal(t, encodeJSON(t, jsonEnc, ent, allFields()), encodeJSON(t, jsonEnc, ent2, fields),
+		"Expected the same JSON after round trip.")
+}
+
+func TestRoundTrip_Context(t *testing.T) {
+	cfg := testEncoderConfig()
+	ctx := []zapcore.Field{nanozap.String("svc", "api"), nanozap.Namespace("req")}
+	fields := []zapcore.Field{nanozap.Int("id", 1)}
+
+	enc := NewEncoder(cfg).Clone()
+	jsonEnc := zapcore.NewJSONEncoder(cfg).Clone()
+	for _, f := range ctx {
+		f.AddTo(enc)
+		f.AddTo(jsonEnc)
+	}
+
+	ent, decoded := roundTrip(t, enc, testEntry(), fields)
+	assert.Equal(t, encodeJSON(t, jsonEnc, testEntry(), fields),
+		encodeJSON(t, zapcore.NewJSONEncoder(cfg), ent, decoded))
+}
+
+func TestRoundTrip_OmittedKeys(t *testing.T) {
+	ent, fields := roundTrip(t, NewEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), testEntry(), nil)
+	assert.Equal(t, zapcore.Entry{Message: "hello"}, ent)
+	assert.Empty(t, fields)
+}
+
+func TestReader_Truncated(t *testing.T) {
+	enc := NewEncoder(testEncoderConfig())
+	var data []byte
+	for i := 0; i < 3; i++ {
+		buf, err := enc.EncodeEntry(testEntry(), allFields())
+		require.NoError(t, err)
+		data = append(data, buf.Bytes()...)
+		buf.Free()
+	}
+
+	for _, cut := range []int{1, 2, 10} {
+		r := NewReader(bytes.NewReader(data[:len(data)-cut]))
+		for i := 0; i < 2; i++ {
+			_, _, err := r.Next()
+			require.NoError(t, err)
+		}
+		_, _, err := r.Next()
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "Expected truncated record with %d bytes cut.", cut)
+	}
+}
+
+func TestDecode_Corrupted(t *testing.T) {
+	enc := NewEncoder(testEncoderConfig())
+	buf, err := enc.EncodeEntry(testEntry(), allFields())
+	require.NoError(t, err)
+	defer buf.Free()
+
+	body := buf.Bytes()[2:] // Skip the length prefix (2 bytes for this size).
+	_, _, err = Decode(body)
+	require.NoError(t, err)
+
+	// A body cut at a top-level field boundary is still well-formed,
+	// so only require that no cut crashes the decoder.
+	for i := 1; i < len(body); i++ {
+		assert.NotPanics(t, func() { Decode(body[:i]) }, "Unexpected panic for the body cut at %d.", i)
+	}
+	_, _, err = Decode(body[:len(body)-1])
+	assert.Error(t, err, "Expected error for the body cut in a nested object.")
+
+	_, _, err = Decode([]byte{version + 1, 0})
+	assert.Error(t, err, "Expected error for unknown version.")
+	_, _, err = Decode([]byte{version, 0, 0xff})
+	assert.Equal(t, ErrCorrupted, err, "Expected error for unknown tag.")
+}
+
+func TestConvert(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := nanozap.New(zapcore.NewCore(NewEncoder(testEncoderConfig()), zapcore.AddSync(out), nanozap.DebugLevel))
+	logger.Info(1, "first")
+	logger.With(nanozap.String("k", "v")).InfoFields(2, "second", nanozap.Int("n", 2))
+	require.NoError(t, logger.Close(context.Background()))
+
+	cfg := testEncoderConfig()
+	cfg.TimeKey = ""
+	js := &bytes.Buffer{}
+	require.NoError(t, Convert(js, bytes.NewReader(out.Bytes()), zapcore.NewJSONEncoder(cfg)))
+	assert.Equal(t, []string{
+		`{"level":"info","msg":"first","reqid":1}`,
+		`{"level":"info","msg":"second","reqid":2,"k":"v","n":2}`,
+	}, strings.Split(strings.TrimSpace(js.String()), "\n"))
+}
+
+func benchmarkEncoder(b *testing.B, enc zapcore.Encoder) {
+	ent := testEntry()
+	ent.Stack = ""
+	fields := []zapcore.Field{
+		nanozap.Int("int", 1),
+		nanozap.Int64("int64", 2),
+		nanozap.Float64("float", 3.0),
+		nanozap.String("string", "four!"),
+		nanozap.Bool("bool", true),
+		nanozap.Time("time", 0),
+		nanozap.NamedError("error", errors.New("fail")),
+		nanozap.Duration("duration", time.Second),
+		nanozap.Ints("ints", []int{1, 2, 3}),
+		nanozap.Strings("strings", []string{"a", "b", "c"}),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ := enc.EncodeEntry(ent, fields)
+		buf.Free()
+	}
+}
+
+func BenchmarkEncoder_Binary(b *testing.B) {
+	benchmarkEncoder(b, NewEncoder(testEncoderConfig()))
+}
+
+func BenchmarkEncoder_JSON(b *testing.B) {
+	benchmarkEncoder(b, zapcore.NewJSONEncoder(testEncoderConfig()))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeEntry(t *testing.T, enc Encoder, ent Entry, fields []Field) string {
+	buf, err := enc.EncodeEntry(ent, fields)
+	require.NoError(t, err, "Unexpected error encoding entry.")
+	defer buf.Free()
+	return buf.String()
+}
+
+func TestConsoleEncoder(t *testing.T) {
+	enc := NewConsoleEncoder(EncoderConfig{
+		TimeKey:       "time",
+		LevelKey:      "level",
+		MessageKey:    "msg",
+		ReqIDKey:      "reqid",
+		CallerKey:     "caller",
+		StacktraceKey: "stacktrace",
+		EncodeTime:    EpochNanosTimeEncoder,
+		EncodeLevel:   LowercaseLevelEncoder,
+		EncodeCaller:  ShortCallerEncoder,
+	})
+	ss := ArrayMarshalerFunc(func(enc ArrayEncoder) error {
+		enc.AppendString("a")
+		enc.AppendString("b")
+		return nil
+	})
+
+	tests := []struct {
+		desc   string
+		ent    Entry
+		fields []Field
+		want   string
+	}{
+		{
+			desc: "no fields",
+			ent:  Entry{Time: 1, Level: InfoLevel, ReqID: 2, Message: "no fields"},
+			want: "1\tinfo\t2\tno fields\n",
+		},
+		{
+			desc: "caller",
+			ent: Entry{Time: 1, Level: WarnLevel, ReqID: 2, Message: "caller",
+				Caller: NewEntryCaller(0, "/path/to/foo/bar.go", 42, true)},
+			want: "1\twarn\t2\tfoo/bar.go:42\tcaller\n",
+		},
+		{
+			desc: "fields",
+			ent:  Entry{Time: 1, Level: InfoLevel, ReqID: 2, Message: "with fields"},
+			fields: []Field{
+				{Key: "k", Type: StringType, String: "v"},
+				{Key: "n", Type: Int64Type, Integer: 1},
+				{Key: "ss", Type: ArrayMarshalerType, Interface: ss},
+			},
+			want: "1\tinfo\t2\twith fields\t{\"k\": \"v\", \"n\": 1, \"ss\": [\"a\", \"b\"]}\n",
+		},
+		{
+			desc: "stacktrace",
+			ent:  Entry{Time: 1, Level: ErrorLevel, ReqID: 2, Message: "with stack", Stack: "foo()\n\tfoo.go:1"},
+			want: "1\terror\t2\twith stack\nfoo()\n\tfoo.go:1\n",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, encodeEntry(t, enc, tt.ent, tt.fields), tt.desc)
+	}
+}
+
+func TestConsoleEncoder_OmitKeys(t *testing.T) {
+	enc := NewConsoleEncoder(EncoderConfig{MessageKey: "msg", LineEnding: "\r\n"})
+	ent := Entry{Time: 1, Level: InfoLevel, ReqID: 2, Message: "only message", Stack: "dropped",
+		Caller: NewEntryCaller(0, "/path/to/foo/bar.go", 42, true)}
+	fields := []Field{{Key: "k", Type: StringType, String: "v"}}
+	assert.Equal(t, "only message\t{\"k\": \"v\"}\r\n", encodeEntry(t, enc, ent, fields))
+}
+
+func TestColorLevelEncoder(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"colored", "\x1b[34minfo\x1b[0m"},
+		{"coloredCapital", "\x1b[34mINFO\x1b[0m"},
+		{"capital", "INFO"},
+		{"", "info"},
+	}
+	for _, tt := range tests {
+		conf := EncoderConfig{LevelKey: "level", MessageKey: "msg"}
+		require.NoError(t, conf.EncodeLevel.UnmarshalText([]byte(tt.name)))
+		got := encodeEntry(t, NewConsoleEncoder(conf), Entry{Level: InfoLevel, Message: "msg"}, nil)
+		assert.Equal(t, fmt.Sprintf("%s\tmsg\n", tt.want), got, "Unexpected level of %q.", tt.name)
+	}
+}
@@ -20,6 +20,8 @@
 
 package zapcore
 
+import "github.com/zaibyte/nanozap/buffer"
+
 // Core is a minimal, fast logger interface. It's designed for library authors
 // to wrap in a more user-friendly API.
 type Core interface {
@@ -44,6 +46,23 @@ type Core interface {
 	Sync() error
 }
 
+// BatchCore is an optional interface of Core. A BatchCore could encode
+// several entries into one buffer and write them to the destination at once,
+// which costs much less than writing them one by one.
+//
+// Entries in a batch are only checked by Enabled, so a BatchCore shouldn't
+// have any extra logic in Check.
+type BatchCore interface {
+	Core
+
+	// AppendEntry serializes the Entry and Fields, and appends them to buf
+	// without writing.
+	AppendEntry(buf *buffer.Buffer, ent Entry, fields []Field) error
+	// WriteBatch writes the entries appended to buf to their destination
+	// in a single write.
+	WriteBatch(buf *buffer.Buffer) error
+}
+
 // NewCore creates a Core that writes logs to a WriteSyncer.
 func NewCore(enc Encoder, ws WriteSyncer, enab LevelEnabler) Core {
 	return &ioCore{
@@ -90,6 +109,21 @@ func (c *ioCore) Write(ent Entry, fields []Field) error {
 	return nil
 }
 
+func (c *ioCore) AppendEntry(buf *buffer.Buffer, ent Entry, fields []Field) error {
+	eb, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	buf.Write(eb.Bytes())
+	eb.Free()
+	return nil
+}
+
+func (c *ioCore) WriteBatch(buf *buffer.Buffer) error {
+	_, err := c.out.Write(buf.Bytes())
+	return err
+}
+
 func (c *ioCore) Sync() error {
 	return c.out.Sync()
 }
@@ -322,6 +322,18 @@ func (enc *jsonEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer,
 	if final.TimeKey != "" {
 		final.AddTime(final.TimeKey, ent.Time)
 	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.addKey(final.CallerKey)
+		cur := final.buf.Len()
+		if final.EncodeCaller != nil {
+			final.EncodeCaller(ent.Caller, final)
+		}
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings to
+			// keep output JSON valid.
+			final.AppendString(ent.Caller.String())
+		}
+	}
 
 	if final.MessageKey != "" {
 		final.addKey(enc.MessageKey)
@@ -331,6 +343,9 @@ func (enc *jsonEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer,
 	if final.ReqIDKey != "" {
 		final.AddUint64(enc.ReqIDKey, ent.ReqID)
 	}
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
 
 	if enc.buf.Len() > 0 {
 		final.addElementSeparator()
@@ -0,0 +1,430 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"encoding/base64"
+	"math"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zaibyte/nanozap/buffer"
+	"github.com/zaibyte/nanozap/internal/bufferpool"
+)
+
+var _logfmtPool = sync.Pool{New: func() interface{} {
+	return &logfmtEncoder{}
+}}
+
+func getLogfmtEncoder() *logfmtEncoder {
+	return _logfmtPool.Get().(*logfmtEncoder)
+}
+
+func putLogfmtEncoder(enc *logfmtEncoder) {
+	enc.EncoderConfig = nil
+	enc.buf = nil
+	enc.namespaces = enc.namespaces[:0]
+	_logfmtPool.Put(enc)
+}
+
+type logfmtEncoder struct {
+	*EncoderConfig
+	buf *buffer.Buffer
+	// namespaces are the prefixes of keys, opened by OpenNamespace & AddObject.
+	namespaces []string
+}
+
+// NewLogfmtEncoder creates an encoder writing entries as logfmt lines like:
+//
+//	time=1577836800 level=info reqid=1 msg="hello world" k=v
+//
+// A value is quoted and escaped only when it's empty or has spaces, '=', '"'
+// or unprintable characters. Illegal characters in keys are replaced by '_'.
+// The fields of an object are flattened with dotted keys (e.g. obj.k=v),
+// and so are namespaces; arrays and reflected values are encoded as JSON.
+func NewLogfmtEncoder(cfg EncoderConfig) Encoder {
+	return &logfmtEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+	}
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr ArrayMarshaler) error {
+	enc.addKey(key)
+	return enc.appendJSON(func(je *jsonEncoder) error {
+		return je.AppendArray(arr)
+	})
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj ObjectMarshaler) error {
+	enc.namespaces = append(enc.namespaces, key)
+	err := obj.MarshalLogObject(enc)
+	enc.namespaces = enc.namespaces[:len(enc.namespaces)-1]
+	return err
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, val []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(val))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, val []byte) {
+	enc.addKey(key)
+	enc.AppendByteString(val)
+}
+
+func (enc *logfmtEncoder) AddBool(key string, val bool) {
+	enc.addKey(key)
+	enc.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, val complex128) {
+	enc.addKey(key)
+	enc.AppendComplex128(val)
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, val time.Duration) {
+	enc.addKey(key)
+	enc.AppendDuration(val)
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, val float64) {
+	enc.addKey(key)
+	enc.AppendFloat64(val)
+}
+
+func (enc *logfmtEncoder) AddInt64(key string, val int64) {
+	enc.addKey(key)
+	enc.AppendInt64(val)
+}
+
+func (enc *logfmtEncoder) AddReflected(key string, obj interface{}) error {
+	enc.addKey(key)
+	return enc.appendJSON(func(je *jsonEncoder) error {
+		return je.AppendReflected(obj)
+	})
+}
+
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.namespaces = append(enc.namespaces, key)
+}
+
+func (enc *logfmtEncoder) AddString(key, val string) {
+	enc.addKey(key)
+	enc.AppendString(val)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, nsec int64) {
+	enc.addKey(key)
+	enc.AppendTime(nsec)
+}
+
+func (enc *logfmtEncoder) AddUint64(key string, val uint64) {
+	enc.addKey(key)
+	enc.AppendUint64(val)
+}
+
+func (enc *logfmtEncoder) AppendBool(val bool) {
+	enc.buf.AppendBool(val)
+}
+
+func (enc *logfmtEncoder) AppendByteString(val []byte) {
+	enc.safeAddString(string(val))
+}
+
+func (enc *logfmtEncoder) AppendComplex128(val complex128) {
+	// Cast to a platform-independent, fixed-size type.
+	r, i := float64(real(val)), float64(imag(val))
+	enc.appendFloat(r, 64)
+	if i >= 0 || math.IsNaN(i) {
+		enc.buf.AppendByte('+')
+	}
+	enc.appendFloat(i, 64)
+	enc.buf.AppendByte('i')
+}
+
+func (enc *logfmtEncoder) AppendDuration(val time.Duration) {
+	cur := enc.buf.Len()
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(val, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeDuration is a no-op. Fall back to nanoseconds.
+		enc.AppendInt64(int64(val))
+	}
+}
+
+func (enc *logfmtEncoder) AppendInt64(val int64) {
+	enc.buf.AppendInt(val)
+}
+
+func (enc *logfmtEncoder) AppendString(val string) {
+	enc.safeAddString(val)
+}
+
+func (enc *logfmtEncoder) AppendTime(nsec int64) {
+	cur := enc.buf.Len()
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(nsec, enc)
+	}
+	if cur == enc.buf.Len() {
+		// User-supplied EncodeTime is a no-op. Fall back to nanos since epoch.
+		enc.AppendInt64(nsec)
+	}
+}
+
+func (enc *logfmtEncoder) AppendUint64(val uint64) {
+	enc.buf.AppendUint(val)
+}
+
+func (enc *logfmtEncoder) AddComplex64(k string, v complex64) { enc.AddComplex128(k, complex128(v)) }
+func (enc *logfmtEncoder) AddFloat32(k string, v float32)     { enc.AddFloat64(k, float64(v)) }
+func (enc *logfmtEncoder) AddInt(k string, v int)             { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt32(k string, v int32)         { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt16(k string, v int16)         { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddInt8(k string, v int8)           { enc.AddInt64(k, int64(v)) }
+func (enc *logfmtEncoder) AddUint(k string, v uint)           { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint32(k string, v uint32)       { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint16(k string, v uint16)       { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUint8(k string, v uint8)         { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AddUintptr(k string, v uintptr)     { enc.AddUint64(k, uint64(v)) }
+func (enc *logfmtEncoder) AppendComplex64(v complex64)        { enc.AppendComplex128(complex128(v)) }
+func (enc *logfmtEncoder) AppendFloat64(v float64)            { enc.appendFloat(v, 64) }
+func (enc *logfmtEncoder) AppendFloat32(v float32)            { enc.appendFloat(float64(v), 32) }
+func (enc *logfmtEncoder) AppendInt(v int)                    { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt32(v int32)                { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt16(v int16)                { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendInt8(v int8)                  { enc.AppendInt64(int64(v)) }
+func (enc *logfmtEncoder) AppendUint(v uint)                  { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint32(v uint32)              { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint16(v uint16)              { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUint8(v uint8)                { enc.AppendUint64(uint64(v)) }
+func (enc *logfmtEncoder) AppendUintptr(v uintptr)            { enc.AppendUint64(uint64(v)) }
+
+func (enc *logfmtEncoder) Clone() Encoder {
+	clone := enc.clone()
+	clone.buf.Write(enc.buf.Bytes())
+	clone.namespaces = append(clone.namespaces, enc.namespaces...)
+	return clone
+}
+
+// clone copies the config only.
+func (enc *logfmtEncoder) clone() *logfmtEncoder {
+	clone := getLogfmtEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.buf = bufferpool.Get()
+	return clone
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent Entry, fields []Field) (*buffer.Buffer, error) {
+	final := enc.clone()
+
+	if final.TimeKey != "" {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if final.LevelKey != "" {
+		final.addKey(final.LevelKey)
+		cur := final.buf.Len()
+		if final.EncodeLevel != nil {
+			final.EncodeLevel(ent.Level, final)
+		}
+		if cur == final.buf.Len() {
+			// User-supplied EncodeLevel was a no-op. Fall back to strings.
+			final.AppendString(ent.Level.String())
+		}
+	}
+	if final.ReqIDKey != "" {
+		final.AddUint64(final.ReqIDKey, ent.ReqID)
+	}
+	if ent.Caller.Defined && final.CallerKey != "" {
+		final.addKey(final.CallerKey)
+		cur := final.buf.Len()
+		if final.EncodeCaller != nil {
+			final.EncodeCaller(ent.Caller, final)
+		}
+		if cur == final.buf.Len() {
+			// User-supplied EncodeCaller was a no-op. Fall back to strings.
+			final.AppendString(ent.Caller.String())
+		}
+	}
+	if final.MessageKey != "" {
+		final.AddString(final.MessageKey, ent.Message)
+	}
+
+	if enc.buf.Len() > 0 {
+		final.addSeparator()
+		final.buf.Write(enc.buf.Bytes())
+	}
+	// Namespaces opened in the context only work on the fields after them.
+	final.namespaces = append(final.namespaces, enc.namespaces...)
+	addFields(final, fields)
+	final.namespaces = final.namespaces[:0]
+
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+
+	if final.LineEnding != "" {
+		final.buf.AppendString(final.LineEnding)
+	} else {
+		final.buf.AppendString(DefaultLineEnding)
+	}
+
+	ret := final.buf
+	putLogfmtEncoder(final)
+	return ret, nil
+}
+
+func (enc *logfmtEncoder) addSeparator() {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+}
+
+// addKey writes the key with namespaces as the prefix.
+func (enc *logfmtEncoder) addKey(key string) {
+	enc.addSeparator()
+	for _, ns := range enc.namespaces {
+		enc.safeAddKey(ns)
+		enc.buf.AppendByte('.')
+	}
+	enc.safeAddKey(key)
+	enc.buf.AppendByte('=')
+}
+
+// appendJSON writes the value encoded by the JSON encoder.
+func (enc *logfmtEncoder) appendJSON(f func(*jsonEncoder) error) error {
+	je := getJSONEncoder()
+	je.EncoderConfig = enc.EncoderConfig
+	je.buf = bufferpool.Get()
+	err := f(je)
+	enc.safeAddString(je.buf.String())
+	je.buf.Free()
+	putJSONEncoder(je)
+	return err
+}
+
+func (enc *logfmtEncoder) appendFloat(val float64, bitSize int) {
+	switch {
+	case math.IsNaN(val):
+		enc.buf.AppendString("NaN")
+	case math.IsInf(val, 1):
+		enc.buf.AppendString("+Inf")
+	case math.IsInf(val, -1):
+		enc.buf.AppendString("-Inf")
+	default:
+		enc.buf.AppendFloat(val, bitSize)
+	}
+}
+
+// safeAddKey writes the key, the characters which are illegal in logfmt keys
+// (spaces, '=', '"' and unprintable ones) are replaced by '_'.
+func (enc *logfmtEncoder) safeAddKey(key string) {
+	if key == "" {
+		enc.buf.AppendByte('_')
+		return
+	}
+	for i := 0; i < len(key); {
+		r, size := rune(key[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(key[i:])
+		}
+		if r == ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r) {
+			enc.buf.AppendByte('_')
+		} else {
+			enc.buf.AppendString(key[i : i+size])
+		}
+		i += size
+	}
+}
+
+// safeAddString writes the value, it's quoted & escaped only if it's needed.
+func (enc *logfmtEncoder) safeAddString(s string) {
+	if !needsQuoting(s) {
+		enc.buf.AppendString(s)
+		return
+	}
+	enc.buf.AppendByte('"')
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			enc.addEscapedByte(b)
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			enc.buf.AppendString(`\ufffd`)
+		} else {
+			enc.buf.AppendString(s[i : i+size])
+		}
+		i += size
+	}
+	enc.buf.AppendByte('"')
+}
+
+func (enc *logfmtEncoder) addEscapedByte(b byte) {
+	switch b {
+	case '\\', '"':
+		enc.buf.AppendByte('\\')
+		enc.buf.AppendByte(b)
+	case '\n':
+		enc.buf.AppendString(`\n`)
+	case '\r':
+		enc.buf.AppendString(`\r`)
+	case '\t':
+		enc.buf.AppendString(`\t`)
+	default:
+		if b < 0x20 || b == 0x7f {
+			enc.buf.AppendString(`\u00`)
+			enc.buf.AppendByte(_hex[b>>4])
+			enc.buf.AppendByte(_hex[b&0xF])
+			return
+		}
+		enc.buf.AppendByte(b)
+	}
+}
+
+// needsQuoting returns true if s is empty or has any space, '=', '"' or
+// unprintable character.
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			if b <= ' ' || b == '=' || b == '"' || b == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapcore
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogfmtEncoder(t *testing.T) {
+	enc := NewLogfmtEncoder(EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		ReqIDKey:       "reqid",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    LowercaseLevelEncoder,
+		EncodeTime:     EpochNanosTimeEncoder,
+		EncodeDuration: StringDurationEncoder,
+	})
+	ent := Entry{Time: 1, Level: InfoLevel, ReqID: 7, Message: "hello world"}
+
+	str := func(key, val string) Field {
+		return Field{Key: key, Type: StringType, String: val}
+	}
+	float := func(key string, val float64) Field {
+		return Field{Key: key, Type: Float64Type, Integer: int64(math.Float64bits(val))}
+	}
+	obj := ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+		enc.AddString("name", "jane doe")
+		return enc.AddObject("inner", ObjectMarshalerFunc(func(enc ObjectEncoder) error {
+			enc.AddInt("n", 1)
+			return nil
+		}))
+	})
+	ss := ArrayMarshalerFunc(func(enc ArrayEncoder) error {
+		enc.AppendString("a")
+		enc.AppendString("b c")
+		return nil
+	})
+	is := ArrayMarshalerFunc(func(enc ArrayEncoder) error {
+		enc.AppendInt(1)
+		enc.AppendInt(2)
+		return nil
+	})
+
+	tests := []struct {
+		desc   string
+		fields []Field
+		want   string
+	}{
+		{"no fields", nil, ""},
+		{"plain string", []Field{str("k", "v")}, " k=v"},
+		{"empty string", []Field{str("k", "")}, ` k=""`},
+		{"spaces", []Field{str("k", "a b")}, ` k="a b"`},
+		{"equal sign", []Field{str("k", "a=b")}, ` k="a=b"`},
+		{"escapes", []Field{str("k", "\"a\\b\"\n\t\x01")}, ` k="\"a\\b\"\n\t\u0001"`},
+		{"unicode", []Field{str("k", "日本語")}, " k=日本語"},
+		{"invalid utf8", []Field{str("k", "\xff")}, ` k="\ufffd"`},
+		{"illegal key", []Field{str("a b=\"c", "v")}, " a_b__c=v"},
+		{"empty key", []Field{str("", "v")}, " _=v"},
+		{"numbers", []Field{
+			{Key: "i", Type: Int64Type, Integer: -1},
+			{Key: "u", Type: Uint64Type, Integer: 2},
+			float("f", 1.5),
+			{Key: "b", Type: BoolType, Integer: 1},
+		}, " i=-1 u=2 f=1.5 b=true"},
+		{"special floats", []Field{float("nan", math.NaN()), float("inf", math.Inf(-1))}, " nan=NaN inf=-Inf"},
+		{"complex", []Field{{Key: "c", Type: Complex128Type, Interface: complex(1, -2)}}, " c=1-2i"},
+		{"duration", []Field{{Key: "d", Type: DurationType, Integer: int64(time.Second)}}, " d=1s"},
+		{"binary", []Field{{Key: "bin", Type: BinaryType, Interface: []byte("ab")}}, ` bin="YWI="`},
+		{"error", []Field{{Key: "err", Type: ErrorType, Interface: errors.New("no such file")}}, ` err="no such file"`},
+		{"object", []Field{{Key: "user", Type: ObjectMarshalerType, Interface: obj}}, ` user.name="jane doe" user.inner.n=1`},
+		{"array", []Field{{Key: "ss", Type: ArrayMarshalerType, Interface: ss}}, ` ss="[\"a\",\"b c\"]"`},
+		{"ints", []Field{{Key: "is", Type: ArrayMarshalerType, Interface: is}}, " is=[1,2]"},
+		{"reflected", []Field{{Key: "r", Type: ReflectType, Interface: map[string]int{"a": 1}}}, ` r="{\"a\":1}"`},
+		{"namespace", []Field{{Key: "ns", Type: NamespaceType}, str("k", "v")}, " ns.k=v"},
+	}
+	prefix := `time=1 level=info reqid=7 msg="hello world"`
+	for _, tt := range tests {
+		assert.Equal(t, prefix+tt.want+"\n", encodeEntry(t, enc, ent, tt.fields), tt.desc)
+	}
+}
+
+func TestLogfmtEncoder_Stacktrace(t *testing.T) {
+	enc := NewLogfmtEncoder(EncoderConfig{MessageKey: "msg", StacktraceKey: "stack"})
+	ent := Entry{Level: ErrorLevel, Message: "oops", Stack: "foo()\n\tfoo.go:1"}
+	assert.Equal(t, "msg=oops stack=\"foo()\\n\\tfoo.go:1\"\n", encodeEntry(t, enc, ent, nil),
+		"Expected stacktrace quoted in one line.")
+}
@@ -0,0 +1,306 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapread
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// _iso8601Layout is the layout used by zapcore.ISO8601TimeEncoder.
+const _iso8601Layout = "2006-01-02T15:04:05.000Z0700"
+
+type timeUnit uint8
+
+const (
+	unknownTime timeUnit = iota
+	secondsTime
+	millisTime
+	nanosTime
+	iso8601Time
+)
+
+type durationUnit uint8
+
+const (
+	unknownDuration durationUnit = iota
+	secondsDuration
+	nanosDuration
+	stringDuration
+)
+
+// Decoder decodes a single line written by the JSON encoder.
+type Decoder struct {
+	cfg      zapcore.EncoderConfig
+	time     timeUnit
+	duration durationUnit
+}
+
+// NewDecoder creates a Decoder for the logs written with cfg.
+//
+// The encoders in zapcore are recognized, the customized ones are decoded in
+// best effort: numbers are taken as nanoseconds, strings are parsed by
+// ISO8601/RFC3339 layouts (time) or time.ParseDuration (duration).
+func NewDecoder(cfg zapcore.EncoderConfig) *Decoder {
+	d := &Decoder{cfg: cfg}
+
+	switch funcPC(cfg.EncodeTime) {
+	case funcPC(zapcore.EpochTimeEncoder):
+		d.time = secondsTime
+	case funcPC(zapcore.EpochMillisTimeEncoder):
+		d.time = millisTime
+	case funcPC(zapcore.EpochNanosTimeEncoder):
+		d.time = nanosTime
+	case funcPC(zapcore.ISO8601TimeEncoder):
+		d.time = iso8601Time
+	}
+
+	switch funcPC(cfg.EncodeDuration) {
+	case funcPC(zapcore.SecondsDurationEncoder):
+		d.duration = secondsDuration
+	case funcPC(zapcore.NanosDurationEncoder):
+		d.duration = nanosDuration
+	case funcPC(zapcore.StringDurationEncoder):
+		d.duration = stringDuration
+	}
+	return d
+}
+
+func funcPC(f interface{}) uintptr {
+	v := reflect.ValueOf(f)
+	if v.IsNil() {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// Decode decodes a line (without line ending) into entry and fields.
+// The keys of entry are removed from fields.
+func (d *Decoder) Decode(line []byte) (ent zapcore.Entry, fields map[string]interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err = dec.Decode(&fields); err != nil {
+		return
+	}
+	if fields == nil {
+		err = errors.New("entry is not a JSON object")
+		return
+	}
+	if dec.More() {
+		err = errors.New("unexpected data after the entry")
+		return
+	}
+
+	if v, ok := pop(fields, d.cfg.LevelKey); ok {
+		if ent.Level, err = d.ParseLevel(v); err != nil {
+			return
+		}
+	}
+	if v, ok := pop(fields, d.cfg.TimeKey); ok {
+		if ent.Time, err = d.ParseTime(v); err != nil {
+			return
+		}
+	}
+	if v, ok := pop(fields, d.cfg.CallerKey); ok {
+		if ent.Caller, err = parseCaller(v); err != nil {
+			return
+		}
+	}
+	if v, ok := pop(fields, d.cfg.MessageKey); ok {
+		if ent.Message, err = toString(d.cfg.MessageKey, v); err != nil {
+			return
+		}
+	}
+	if v, ok := pop(fields, d.cfg.ReqIDKey); ok {
+		if ent.ReqID, err = parseUint(d.cfg.ReqIDKey, v); err != nil {
+			return
+		}
+	}
+	if v, ok := pop(fields, d.cfg.StacktraceKey); ok {
+		if ent.Stack, err = toString(d.cfg.StacktraceKey, v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func pop(fields map[string]interface{}, key string) (interface{}, bool) {
+	if key == "" {
+		return nil, false
+	}
+	v, ok := fields[key]
+	if ok {
+		delete(fields, key)
+	}
+	return v, ok
+}
+
+// ParseLevel parses a level encoded by the level encoders in zapcore,
+// ANSI colors are removed.
+func (d *Decoder) ParseLevel(v interface{}) (zapcore.Level, error) {
+	s, err := toString("level", v)
+	if err != nil {
+		return 0, err
+	}
+	var l zapcore.Level
+	err = l.UnmarshalText([]byte(stripColor(s)))
+	return l, err
+}
+
+// stripColor removes the ANSI escape sequences (e.g. "\x1b[34m") in s.
+func stripColor(s string) string {
+	if strings.IndexByte(s, '\x1b') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '[' {
+			j := i + 2
+			for j < len(s) && s[j] != 'm' {
+				j++
+			}
+			i = j
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// ParseTime parses a time encoded by the EncodeTime of the config,
+// it returns Unix timestamp in nanoseconds.
+func (d *Decoder) ParseTime(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		switch d.time {
+		case secondsTime:
+			return scaleNumber(x, int64(time.Second))
+		case millisTime:
+			return scaleNumber(x, int64(time.Millisecond))
+		case iso8601Time:
+			return 0, fmt.Errorf("unexpected number time: %s", x)
+		default:
+			return scaleNumber(x, 1)
+		}
+	case string:
+		if d.time != iso8601Time && d.time != unknownTime {
+			return 0, fmt.Errorf("unexpected string time: %q", x)
+		}
+		t, err := time.Parse(_iso8601Layout, x)
+		if err != nil && d.time == unknownTime {
+			t, err = time.Parse(time.RFC3339Nano, x)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return t.UnixNano(), nil
+	default:
+		return 0, fmt.Errorf("unexpected time type: %T", v)
+	}
+}
+
+// ParseDuration parses a duration encoded by the EncodeDuration of the config.
+// Durations in fields are not marked, so users should pick them by keys.
+func (d *Decoder) ParseDuration(v interface{}) (time.Duration, error) {
+	switch x := v.(type) {
+	case json.Number:
+		switch d.duration {
+		case secondsDuration:
+			n, err := scaleNumber(x, int64(time.Second))
+			return time.Duration(n), err
+		case stringDuration:
+			return 0, fmt.Errorf("unexpected number duration: %s", x)
+		default:
+			n, err := scaleNumber(x, 1)
+			return time.Duration(n), err
+		}
+	case string:
+		if d.duration != stringDuration && d.duration != unknownDuration {
+			return 0, fmt.Errorf("unexpected string duration: %q", x)
+		}
+		return time.ParseDuration(x)
+	default:
+		return 0, fmt.Errorf("unexpected duration type: %T", v)
+	}
+}
+
+// scaleNumber returns n*scale, n could be a float (e.g. seconds).
+func scaleNumber(n json.Number, scale int64) (int64, error) {
+	if i, err := n.Int64(); err == nil {
+		if i > math.MaxInt64/scale || i < math.MinInt64/scale {
+			return 0, fmt.Errorf("number overflow: %s", n)
+		}
+		return i * scale, nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return 0, err
+	}
+	f = math.Round(f * float64(scale))
+	if f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("number overflow: %s", n)
+	}
+	return int64(f), nil
+}
+
+// parseCaller parses file:line written by FullCallerEncoder
+// or ShortCallerEncoder. Only File & Line are set.
+func parseCaller(v interface{}) (zapcore.EntryCaller, error) {
+	s, err := toString("caller", v)
+	if err != nil {
+		return zapcore.EntryCaller{}, err
+	}
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return zapcore.EntryCaller{}, fmt.Errorf("illegal caller: %q", s)
+	}
+	line, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return zapcore.EntryCaller{}, fmt.Errorf("illegal caller: %q", s)
+	}
+	return zapcore.NewEntryCaller(0, s[:i], line, true), nil
+}
+
+func parseUint(key string, v interface{}) (uint64, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("unexpected %s type: %T", key, v)
+	}
+	return strconv.ParseUint(n.String(), 10, 64)
+}
+
+func toString(key string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected %s type: %T", key, v)
+	}
+	return s, nil
+}
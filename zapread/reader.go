@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package zapread reads the logs written by the JSON encoder back into
+// zapcore.Entry and a field map, so tools (replay, grep by reqid, stats ...)
+// needn't parse logs by themselves.
+//
+// The keys and the time/level/duration/caller encoders are taken from the
+// EncoderConfig which the logs were written with. Fields are decoded by
+// encoding/json with numbers kept as json.Number, and the fields which have
+// the same key as the entry's are shadowed by the entry.
+package zapread
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+// LineError is returned when a line can't be decoded.
+// The Reader is still usable after a LineError.
+type LineError struct {
+	Line int // Line number, starting from 1.
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("zapread: line %d: %v", e.Line, e.Err)
+}
+
+// Reader reads log entries line by line.
+type Reader struct {
+	dec       *Decoder
+	r         *bufio.Reader
+	ending    []byte
+	line      int
+	truncated bool
+}
+
+// NewReader creates a Reader reading the logs written with cfg from r.
+func NewReader(r io.Reader, cfg zapcore.EncoderConfig) *Reader {
+	ending := cfg.LineEnding
+	if ending == "" {
+		ending = zapcore.DefaultLineEnding
+	}
+	return &Reader{
+		dec:    NewDecoder(cfg),
+		r:      bufio.NewReader(r),
+		ending: []byte(ending),
+	}
+}
+
+// Next reads the next entry and its fields.
+//
+// It returns io.EOF if there is no more entry. If the last line is not
+// terminated by the line ending and can't be decoded (the writer may be still
+// writing it), it's skipped and Truncated will return true.
+// Blank lines are skipped too.
+func (r *Reader) Next() (zapcore.Entry, map[string]interface{}, error) {
+	for {
+		line, err := r.readLine()
+		if err != nil && err != io.EOF {
+			return zapcore.Entry{}, nil, err
+		}
+		complete := err == nil
+		if len(bytes.TrimSpace(line)) == 0 {
+			if complete {
+				continue
+			}
+			return zapcore.Entry{}, nil, io.EOF
+		}
+
+		r.line++
+		ent, fields, derr := r.dec.Decode(line)
+		if derr != nil {
+			if !complete {
+				r.truncated = true
+				return zapcore.Entry{}, nil, io.EOF
+			}
+			return zapcore.Entry{}, nil, &LineError{Line: r.line, Err: derr}
+		}
+		return ent, fields, nil
+	}
+}
+
+// Truncated returns true if the last line is truncated.
+// It's only meaningful after Next returning io.EOF.
+func (r *Reader) Truncated() bool {
+	return r.truncated
+}
+
+// Line returns the number of the last line read.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// readLine reads until the line ending (trimmed).
+// It returns io.EOF with the remaining bytes if there is no line ending.
+func (r *Reader) readLine() ([]byte, error) {
+	last := r.ending[len(r.ending)-1]
+	var line []byte
+	for {
+		b, err := r.r.ReadBytes(last)
+		line = append(line, b...)
+		if err != nil {
+			return line, err
+		}
+		if bytes.HasSuffix(line, r.ending) {
+			return line[:len(line)-len(r.ending)], nil
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+// Copyright (c) 2020 Temple3x
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zapread
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zaibyte/nanozap"
+	"github.com/zaibyte/nanozap/zapcore"
+)
+
+func testEncoderConfig() zapcore.EncoderConfig {
+	return zapcore.EncoderConfig{
+		TimeKey:        "time",
+		LevelKey:       "level",
+		MessageKey:     "msg",
+		ReqIDKey:       "reqid",
+		CallerKey:      "caller",
+		StacktraceKey:  "stacktrace",
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.EpochNanosTimeEncoder,
+		EncodeDuration: zapcore.NanosDurationEncoder,
+		EncodeCaller:   zapcore.FullCallerEncoder,
+	}
+}
+
+func encodeLines(t *testing.T, cfg zapcore.EncoderConfig, ents ...zapcore.Entry) []byte {
+	enc := zapcore.NewJSONEncoder(cfg)
+	var out []byte
+	for _, ent := range ents {
+		buf, err := enc.EncodeEntry(ent, []zapcore.Field{
+			nanozap.Duration("elapsed", 1500*time.Millisecond),
+			nanozap.Int("n", 1),
+			nanozap.Object("obj", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("k", "v")
+				return nil
+			})),
+		})
+		require.NoError(t, err)
+		out = append(out, buf.Bytes()...)
+		buf.Free()
+	}
+	return out
+}
+
+func testEntry() zapcore.Entry {
+	return zapcore.Entry{
+		Level:   zapcore.ErrorLevel,
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC).UnixNano(),
+		Message: "hello",
+		ReqID:   42,
+		Caller:  zapcore.NewEntryCaller(0, "/a/b/c.go", 10, true),
+		Stack:   "main.main\n\t/a/b/c.go:10",
+	}
+}
+
+func TestReader_Encoders(t *testing.T) {
+	ent := testEntry()
+	tests := []struct {
+		desc   string
+		modify func(cfg *zapcore.EncoderConfig)
+		time   int64
+		caller string
+	}{
+		{"default", func(cfg *zapcore.EncoderConfig) {}, ent.Time, "/a/b/c.go"},
+		{"epoch", func(cfg *zapcore.EncoderConfig) {
+			cfg.EncodeTime = zapcore.EpochTimeEncoder
+			cfg.EncodeDuration = zapcore.SecondsDurationEncoder
+		}, ent.Time / int64(time.Second) * int64(time.Second), "/a/b/c.go"},
+		{"millis", func(cfg *zapcore.EncoderConfig) {
+			cfg.EncodeTime = zapcore.EpochMillisTimeEncoder
+			cfg.EncodeDuration = zapcore.StringDurationEncoder
+			cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		}, ent.Time, "/a/b/c.go"},
+		{"iso8601", func(cfg *zapcore.EncoderConfig) {
+			cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+			cfg.EncodeLevel = zapcore.CapitalColorLevelEncoder
+			cfg.EncodeCaller = zapcore.ShortCallerEncoder
+		}, ent.Time, "b/c.go"},
+		{"colored", func(cfg *zapcore.EncoderConfig) {
+			cfg.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+			cfg.LineEnding = "\r\n"
+		}, ent.Time, "/a/b/c.go"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := testEncoderConfig()
+			tt.modify(&cfg)
+			r := NewReader(bytes.NewReader(encodeLines(t, cfg, ent, ent)), cfg)
+			dec := NewDecoder(cfg)
+
+			for i := 0; i < 2; i++ {
+				got, fields, err := r.Next()
+				require.NoError(t, err)
+				assert.Equal(t, ent.Level, got.Level)
+				assert.Equal(t, tt.time, got.Time)
+				assert.Equal(t, ent.Message, got.Message)
+				assert.Equal(t, ent.ReqID, got.ReqID)
+				assert.Equal(t, ent.Stack, got.Stack)
+				assert.Equal(t, tt.caller, got.Caller.File)
+				assert.Equal(t, 10, got.Caller.Line)
+
+				assert.Equal(t, map[string]interface{}{
+					"elapsed": fields["elapsed"],
+					"n":       json.Number("1"),
+					"obj":     map[string]interface{}{"k": "v"},
+				}, fields)
+				d, err := dec.ParseDuration(fields["elapsed"])
+				require.NoError(t, err)
+				assert.Equal(t, 1500*time.Millisecond, d)
+			}
+			_, _, err := r.Next()
+			assert.Equal(t, io.EOF, err)
+			assert.False(t, r.Truncated())
+			assert.Equal(t, 2, r.Line())
+		})
+	}
+}
+
+func TestReader_OmittedKeys(t *testing.T) {
+	cfg := zapcore.EncoderConfig{MessageKey: "msg"}
+	r := NewReader(strings.NewReader(`{"msg":"m","level":"info"}`+"\n"), cfg)
+	ent, fields, err := r.Next()
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.Entry{Message: "m"}, ent)
+	assert.Equal(t, map[string]interface{}{"level": "info"}, fields)
+}
+
+func TestReader_Truncated(t *testing.T) {
+	cfg := testEncoderConfig()
+	data := encodeLines(t, cfg, testEntry(), testEntry())
+
+	r := NewReader(bytes.NewReader(data[:len(data)-5]), cfg)
+	_, _, err := r.Next()
+	require.NoError(t, err)
+	_, _, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, r.Truncated())
+
+	// The last line is complete except the line ending.
+	r = NewReader(bytes.NewReader(data[:len(data)-1]), cfg)
+	for i := 0; i < 2; i++ {
+		_, _, err = r.Next()
+		require.NoError(t, err)
+	}
+	_, _, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+	assert.False(t, r.Truncated())
+}
+
+func TestReader_BadLine(t *testing.T) {
+	cfg := testEncoderConfig()
+	ent := encodeLines(t, cfg, testEntry())
+	data := append(append(append([]byte{}, ent...), "\n{bad\n"+`{"level":1}`+"\n"...), ent...)
+
+	r := NewReader(bytes.NewReader(data), cfg)
+	_, _, err := r.Next()
+	require.NoError(t, err)
+
+	for _, line := range []int{2, 3} {
+		_, _, err = r.Next()
+		require.Error(t, err)
+		le, ok := err.(*LineError)
+		require.True(t, ok, "Expected *LineError, got %T.", err)
+		assert.Equal(t, line, le.Line)
+	}
+
+	_, _, err = r.Next()
+	assert.NoError(t, err, "Expected the Reader still usable after bad lines.")
+	_, _, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReader_Logger(t *testing.T) {
+	cfg := testEncoderConfig()
+	out := &bytes.Buffer{}
+	logger := nanozap.New(zapcore.NewCore(zapcore.NewJSONEncoder(cfg), zapcore.AddSync(out), nanozap.DebugLevel),
+		nanozap.AddCaller())
+	start := time.Now().UnixNano()
+	logger.Warn(7, "warned")
+	require.NoError(t, logger.Close(context.Background()))
+
+	ent, fields, err := NewReader(out, cfg).Next()
+	require.NoError(t, err)
+	assert.Equal(t, zapcore.WarnLevel, ent.Level)
+	assert.Equal(t, "warned", ent.Message)
+	assert.Equal(t, uint64(7), ent.ReqID)
+	assert.True(t, ent.Time >= start, "Unexpected entry time.")
+	assert.True(t, strings.HasSuffix(ent.Caller.File, "zapread/reader_test.go"), "Unexpected caller: %s.", ent.Caller)
+	assert.Empty(t, fields)
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	dec := NewDecoder(testEncoderConfig())
+	for _, line := range []string{
+		`null`,
+		`{"time":"2020"}`,
+		`{"level":"unknown"}`,
+		`{"reqid":-1}`,
+		`{"caller":"c.go"}`,
+		`{"msg":1}`,
+		`{} {}`,
+	} {
+		_, _, err := dec.Decode([]byte(line))
+		assert.Error(t, err, "Expected error decoding %s.", line)
+	}
+}
@@ -13,19 +13,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
-// Backup holds backup log file' path & create time.
+// Backup holds backup log file' path, create time & size.
 type Backup struct {
-	ts int64
-	fp string
+	ts   int64
+	fp   string
+	size int64
 }
 
 // Backups implements heap interface.
 type Backups struct {
-	bs []Backup
+	bs    []Backup
+	total int64 // Total size of backups.
 }
 
 func (b *Backups) Less(i, j int) bool {
@@ -44,14 +47,49 @@ func (b *Backups) Len() int {
 
 func (b *Backups) Pop() (v interface{}) {
 	if b.Len() > 0 {
-		v = (*b).bs[b.Len()-1]
+		bk := (*b).bs[b.Len()-1]
 		b.bs = (*b).bs[:b.Len()-1]
+		b.total -= bk.size
+		v = bk
 	}
 	return
 }
 
 func (b *Backups) Push(v interface{}) {
-	b.bs = append((*b).bs, v.(Backup))
+	bk := v.(Backup)
+	b.bs = append((*b).bs, bk)
+	b.total += bk.size
+}
+
+// replace replaces the path & size of backup,
+// returns false if there is no such backup.
+func (b *Backups) replace(oldFP, newFP string, size int64) bool {
+	for i := range b.bs {
+		if b.bs[i].fp == oldFP {
+			b.total += size - b.bs[i].size
+			b.bs[i].fp = newFP
+			b.bs[i].size = size
+			return true
+		}
+	}
+	return false
+}
+
+// retain removes the oldest backups until:
+// there are no more than max backups,
+// none of them is older than maxAge (if maxAge > 0),
+// and the total size is no more than maxTotalSize (if maxTotalSize > 0).
+func (b *Backups) retain(max int, maxAge time.Duration, maxTotalSize int64, now time.Time) {
+	for b.Len() > 0 {
+		oldest := b.bs[0] // Heap's root is the min.
+		if b.Len() <= max &&
+			(maxAge <= 0 || oldest.ts >= now.Add(-maxAge).Unix()) &&
+			(maxTotalSize <= 0 || b.total <= maxTotalSize) {
+			return
+		}
+		heap.Pop(b)
+		os.Remove(oldest.fp)
+	}
 }
 
 func listBackups(outputPath string, max int) (*Backups, error) {
@@ -91,19 +129,61 @@ func (b *Backups) list(outputPath string, max int) error {
 			continue
 		}
 		if ts := parseTime(f.Name(), prefix, ext); ts != 0 {
-			heap.Push(b, Backup{ts, filepath.Join(dir, f.Name())})
+			var size int64
+			if fi, err := f.Info(); err == nil {
+				size = fi.Size()
+			}
+			heap.Push(b, Backup{ts, filepath.Join(dir, f.Name()), size})
 			continue
 		}
+		// Remove the temporary file left by compressing.
+		if strings.HasSuffix(f.Name(), compressTmpExt) &&
+			parseTime(strings.TrimSuffix(f.Name(), compressTmpExt), prefix, ext) != 0 {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
 	}
 
-	for b.Len() > max {
-		v := heap.Pop(b)
-		os.Remove(v.(Backup).fp)
-	}
+	b.retain(max, 0, 0, time.Time{})
 
 	return nil
 }
 
+// ListBackups returns the backup log files of outputPath from oldest to newest.
+// Different from listBackups, it's read-only, made for tools reading logs.
+func ListBackups(outputPath string) ([]string, error) {
+
+	dir := filepath.Dir(outputPath)
+	ns, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ext := getPrefixAndExt(outputPath)
+
+	bs := make([]Backup, 0, len(ns))
+	for _, f := range ns {
+		if f.IsDir() {
+			continue
+		}
+		if ts := parseTime(f.Name(), prefix, ext); ts != 0 {
+			bs = append(bs, Backup{ts: ts, fp: filepath.Join(dir, f.Name())})
+		}
+	}
+	// ts is in seconds, the name (with milliseconds) breaks the tie.
+	sort.Slice(bs, func(i, j int) bool {
+		if bs[i].ts != bs[j].ts {
+			return bs[i].ts < bs[j].ts
+		}
+		return bs[i].fp < bs[j].fp
+	})
+
+	fps := make([]string, len(bs))
+	for i := range bs {
+		fps[i] = bs[i].fp
+	}
+	return fps, nil
+}
+
 // getPrefixAndExt returns the filename part and extension part from the rotation's filename.
 func getPrefixAndExt(outputPath string) (prefix, ext string) {
 	name := filepath.Base(outputPath)
@@ -115,11 +195,11 @@ func getPrefixAndExt(outputPath string) (prefix, ext string) {
 const backupTimeFmt = "2006-01-02T15:04:05.000Z0700"
 
 // parseTime extracts the formatted time from the filename by stripping off
-// the filename's prefix and extension.
+// the filename's prefix and extension (and the extension of compressor).
 //
 // Return 0 if the file is illegal zaproll backup file.
 func parseTime(fp, prefix, ext string) int64 {
-	filename := filepath.Base(fp)
+	filename := trimCompressExt(filepath.Base(fp))
 	if !strings.HasPrefix(filename, prefix) {
 		return 0
 	}
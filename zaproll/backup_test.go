@@ -64,6 +64,12 @@ func testListBackupsPathError(t *testing.T, maxBackups int) {
 		t.Fatal(err)
 	}
 	os.RemoveAll(dir)
+	// Removing dir isn't enough: Backups.list makes the dir by os.MkdirAll
+	// if it doesn't exist, so put a file in the place of dir to get the error.
+	if err = ioutil.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
 	fn := "zaproll-test.log"
 	output := filepath.Join(dir, fn)
 
@@ -141,6 +147,107 @@ func testListBackups(t *testing.T, i, maxBackups int) {
 	}
 }
 
+func TestListBackups_ReadOnly(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "zaproll-test.log")
+
+	fps, err := ListBackups(output)
+	if err != nil || len(fps) != 0 {
+		t.Fatal("should be empty", err)
+	}
+
+	// Milliseconds apart, in the same second.
+	now := time.Unix(time.Now().Unix(), 0)
+	exp := make([]string, 6)
+	for i := len(exp) - 1; i >= 0; i-- {
+		exp[i], _ = makeBackupFP(output, false, now.Add(time.Duration(i)*time.Millisecond*100))
+		if _, err = os.Create(exp[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Create(filepath.Join(dir, "zaproll-test-a.log"))
+
+	fps, err = ListBackups(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != len(exp) {
+		t.Fatal("mismatch backups len")
+	}
+	for i := range exp {
+		if fps[i] != exp[i] {
+			t.Fatal("mismatch backup order", i, fps[i], exp[i])
+		}
+	}
+
+	if _, err = ListBackups(filepath.Join(dir, "not-exist", "a.log")); err == nil {
+		t.Fatal("should raise path error")
+	}
+}
+
+func TestBackups_Retain(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC)
+	makeDays := func() *Backups {
+		b := &Backups{}
+		for i := 1; i <= 5; i++ { // 1-5 days ago, 10 bytes each.
+			fp := filepath.Join(dir, strconv.Itoa(i))
+			if err := ioutil.WriteFile(fp, make([]byte, 10), 0644); err != nil {
+				t.Fatal(err)
+			}
+			heap.Push(b, Backup{ts: now.AddDate(0, 0, -i).Unix(), fp: fp, size: 10})
+		}
+		return b
+	}
+	exist := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	tests := []struct {
+		max     int
+		maxAge  time.Duration
+		maxSize int64
+		expect  int
+	}{
+		{10, 0, 0, 5},
+		{3, 0, 0, 3},
+		{10, 3 * 24 * time.Hour, 0, 3},
+		{10, 3*24*time.Hour - time.Second, 0, 2}, // ts is in seconds.
+		{10, 0, 30, 3},
+		{10, 0, 29, 2},
+		{10, 0, 1, 0},
+		{4, 3 * 24 * time.Hour, 20, 2},
+	}
+	for i, tt := range tests {
+		b := makeDays()
+		b.retain(tt.max, tt.maxAge, tt.maxSize, now)
+		if b.Len() != tt.expect {
+			t.Fatal("mismatch backups len", i, b.Len())
+		}
+		if b.total != int64(tt.expect)*10 {
+			t.Fatal("mismatch total size", i, b.total)
+		}
+		for j := 1; j <= 5; j++ { // The newest ones are retained.
+			if exist(strconv.Itoa(j)) != (j <= tt.expect) {
+				t.Fatal("mismatch backup file", i, j)
+			}
+		}
+	}
+}
+
 func TestGetPrefixAndExt(t *testing.T) {
 	output := "a/b.log"
 	prefix, ext := getPrefixAndExt(output)
@@ -97,6 +97,12 @@ func (b *bufIO) flush() (flushed int, err error) {
 	return n, nil
 }
 
+// clearErr clears the error, so the buffer accepts data again.
+// The buffered data remains.
+func (b *bufIO) clearErr() {
+	b.err = nil
+}
+
 // avail returns how many bytes are unused in the buffer.
 func (b *bufIO) avail() int { return len(b.buf) - b.n }
 
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"time"
+)
+
+// clock is the source of time of Rotation,
+// it's replaced by a fake one in testing.
+type clock interface {
+	Now() time.Time
+	// NewTimer returns a channel which will get the time after d,
+	// and a function to stop it.
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// nextRotateTime returns the first rotation time after now.
+//
+// Rotations are planned on the wall clock of now's location, so they stay
+// on time across DST changes. Intervals up to a day restart at (midnight + at)
+// every day, so daily rotations happen at midnight and hourly rotations happen
+// on the hour. Longer intervals are rounded down to whole days counted from
+// the Unix epoch.
+func nextRotateTime(now time.Time, every, at time.Duration) time.Time {
+	const day = 24 * time.Hour
+
+	days := 1
+	if every > day {
+		days = int(every / day)
+	}
+	y, m, d := now.Date()
+	n := int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()/86400) % days
+	if n < 0 {
+		n += days
+	}
+	d -= n
+	start := dayStart(now.Location(), y, m, d, at)
+	for start.After(now) {
+		d -= days
+		start = dayStart(now.Location(), y, m, d, at)
+	}
+	end := dayStart(now.Location(), y, m, d+days, at)
+	if every < day {
+		next := start.Add((now.Sub(start)/every + 1) * every)
+		if next.Before(end) {
+			return next
+		}
+	}
+	return end
+}
+
+// dayStart returns the wall clock time at after the midnight of the day.
+func dayStart(loc *time.Location, y int, m time.Month, d int, at time.Duration) time.Time {
+	return time.Date(y, m, d, 0, 0, int(at/time.Second), int(at%time.Second), loc)
+}
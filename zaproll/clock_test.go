@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // For the DST test on systems without zoneinfo.
+)
+
+func TestNextRotateTime(t *testing.T) {
+
+	cst := time.FixedZone("CST", 8*3600)
+	nst := time.FixedZone("NST", -3*3600-1800)
+
+	tests := []struct {
+		now    time.Time
+		every  time.Duration
+		at     time.Duration
+		expect time.Time
+	}{
+		// Hourly.
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), time.Hour, 0,
+			time.Date(2020, 1, 2, 4, 0, 0, 0, time.UTC)},
+		{time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC), time.Hour, 0,
+			time.Date(2020, 1, 2, 4, 0, 0, 0, time.UTC)},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, nst), time.Hour, 0,
+			time.Date(2020, 1, 2, 4, 0, 0, 0, nst)},
+		// Daily.
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), 24 * time.Hour, 0,
+			time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, cst), 24 * time.Hour, 0,
+			time.Date(2020, 1, 3, 0, 0, 0, 0, cst)},
+		{time.Date(2020, 1, 2, 1, 0, 0, 0, cst), 24 * time.Hour, 2 * time.Hour,
+			time.Date(2020, 1, 2, 2, 0, 0, 0, cst)},
+		{time.Date(2020, 1, 2, 3, 0, 0, 0, cst), 24 * time.Hour, 2 * time.Hour,
+			time.Date(2020, 1, 3, 2, 0, 0, 0, cst)},
+		// Arbitrary.
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), 15 * time.Minute, 0,
+			time.Date(2020, 1, 2, 3, 15, 0, 0, time.UTC)},
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), 7 * time.Second, 0, // Restarted at midnight.
+			time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)},
+		{time.Date(2020, 1, 2, 23, 59, 58, 0, time.UTC), 7 * time.Second, 0, // Cut at midnight.
+			time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		// Days.
+		{time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), 48 * time.Hour, 0, // 2020-01-01 is an even day since epoch.
+			time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2020, 1, 3, 3, 4, 5, 0, time.UTC), 48 * time.Hour, 2 * time.Hour,
+			time.Date(2020, 1, 5, 2, 0, 0, 0, time.UTC)},
+		// Before epoch.
+		{time.Date(1969, 12, 31, 23, 30, 0, 0, time.UTC), time.Hour, 0,
+			time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(1969, 12, 31, 23, 0, 0, 0, time.UTC), time.Hour, 0,
+			time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for i, tt := range tests {
+		act := nextRotateTime(tt.now, tt.every, tt.at)
+		if !act.Equal(tt.expect) {
+			t.Fatal("mismatch next rotate time", i, act, tt.expect)
+		}
+		if act.Location() != tt.now.Location() {
+			t.Fatal("mismatch location", i)
+		}
+	}
+}
+
+func TestNextRotateTimeDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+
+	// 2020-03-08 02:00 EST -> 03:00 EDT, 2020-11-01 02:00 EDT -> 01:00 EST.
+	tests := []struct {
+		now    time.Time
+		every  time.Duration
+		at     time.Duration
+		expect time.Time
+	}{
+		// Daily, the days are 23 and 25 hours long.
+		{time.Date(2020, 3, 8, 0, 30, 0, 0, ny), 24 * time.Hour, 0,
+			time.Date(2020, 3, 9, 0, 0, 0, 0, ny)},
+		{time.Date(2020, 11, 1, 0, 30, 0, 0, ny), 24 * time.Hour, 0,
+			time.Date(2020, 11, 2, 0, 0, 0, 0, ny)},
+		{time.Date(2020, 3, 8, 0, 30, 0, 0, ny), 24 * time.Hour, 4 * time.Hour,
+			time.Date(2020, 3, 8, 4, 0, 0, 0, ny)},
+		{time.Date(2020, 11, 1, 0, 30, 0, 0, ny), 24 * time.Hour, 4 * time.Hour,
+			time.Date(2020, 11, 1, 4, 0, 0, 0, ny)},
+		// Hourly, on the hour.
+		{time.Date(2020, 3, 8, 1, 30, 0, 0, ny), time.Hour, 0,
+			time.Date(2020, 3, 8, 3, 0, 0, 0, ny)},
+		{time.Date(2020, 11, 1, 1, 30, 0, 0, ny).Add(time.Hour), time.Hour, 0, // The second 01:30 (EST).
+			time.Date(2020, 11, 1, 2, 0, 0, 0, ny)},
+	}
+
+	for i, tt := range tests {
+		act := nextRotateTime(tt.now, tt.every, tt.at)
+		if !act.Equal(tt.expect) {
+			t.Fatal("mismatch next rotate time", i, act, tt.expect)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Compressor compresses backup log files.
+type Compressor interface {
+	// Ext is the extension appended to compressed backups, e.g. ".gz".
+	Ext() string
+	// NewWriter returns a writer compressing data to w,
+	// it must be closed for flushing.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing data from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Ext() string {
+	return ".gz"
+}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	errNoCompressorName = errors.New("no compressor name specified")
+
+	_compressorMutex sync.RWMutex
+	_compressors     = map[string]Compressor{
+		"gzip": gzipCompressor{},
+	}
+)
+
+// RegisterCompressor registers a compressor, which could be used by
+// Config.Compress with the name. "gzip" is registered by default.
+// It returns an error if the name has been registered.
+func RegisterCompressor(name string, c Compressor) error {
+	_compressorMutex.Lock()
+	defer _compressorMutex.Unlock()
+	if name == "" {
+		return errNoCompressorName
+	}
+	if _, dup := _compressors[name]; dup {
+		return fmt.Errorf("compressor already registered for name %q", name)
+	}
+	_compressors[name] = c
+	return nil
+}
+
+func getCompressor(name string) (Compressor, error) {
+	_compressorMutex.RLock()
+	defer _compressorMutex.RUnlock()
+	c, ok := _compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("no compressor registered for name %q", name)
+	}
+	return c, nil
+}
+
+// compressorOf returns the compressor of a compressed backup by its extension,
+// nil if it's not compressed.
+func compressorOf(fp string) Compressor {
+	_compressorMutex.RLock()
+	defer _compressorMutex.RUnlock()
+	for _, c := range _compressors {
+		if strings.HasSuffix(fp, c.Ext()) {
+			return c
+		}
+	}
+	return nil
+}
+
+// trimCompressExt removes the extension of compressor in fp (if has).
+func trimCompressExt(fp string) string {
+	if c := compressorOf(fp); c != nil {
+		return fp[:len(fp)-len(c.Ext())]
+	}
+	return fp
+}
+
+// OpenBackup opens a backup log file for reading,
+// and decompresses it if it's compressed.
+func OpenBackup(fp string) (io.ReadCloser, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	c := compressorOf(fp)
+	if c == nil {
+		return f, nil
+	}
+	r, err := c.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &backupReader{ReadCloser: r, f: f}, nil
+}
+
+type backupReader struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r *backupReader) Close() error {
+	err := r.ReadCloser.Close()
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+const compressTmpExt = ".tmp"
+
+// compressLater adds backup to the compressing queue.
+func (r *Rotation) compressLater(fp string) {
+	if r.compressor == nil || compressorOf(fp) != nil {
+		return
+	}
+	r.pending = append(r.pending, fp)
+	select {
+	case r.compressC <- struct{}{}:
+	default:
+	}
+}
+
+// compressLoop compresses backups in the background.
+// The backups left uncompressed after closing will be compressed by
+// next Rotation.
+func (r *Rotation) compressLoop() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.compressC:
+		case <-r.done:
+			return
+		}
+
+		for {
+			r.locker.Lock()
+			if len(r.pending) == 0 {
+				r.locker.Unlock()
+				break
+			}
+			fp := r.pending[0]
+			r.pending = r.pending[1:]
+			r.locker.Unlock()
+
+			r.compressBackup(fp)
+
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// compressBackup compresses src to src+Ext, then removes src.
+// If src has been removed (because of too many backups), it gives up.
+func (r *Rotation) compressBackup(src string) {
+	dst := src + r.compressor.Ext()
+	tmp := dst + compressTmpExt
+	if err := compressFile(r.compressor, src, tmp); err != nil {
+		os.Remove(tmp)
+		if !os.IsNotExist(err) { // Not removed by retention.
+			r.locker.Lock()
+			r.report(fmt.Errorf("failed to compress backup: %s: %s", src, err.Error()))
+			r.locker.Unlock()
+		}
+		return
+	}
+
+	var srcSize, dstSize int64
+	if fi, err := os.Stat(tmp); err == nil {
+		dstSize = fi.Size()
+	}
+	if fi, err := os.Stat(src); err == nil {
+		srcSize = fi.Size()
+	}
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if !r.backups.replace(src, dst, dstSize) {
+		os.Remove(tmp)
+		return
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		r.backups.replace(dst, src, srcSize)
+		os.Remove(tmp)
+		r.report(fmt.Errorf("failed to rename compressed backup: %s: %s", dst, err.Error()))
+		return
+	}
+	os.Remove(src)
+}
+
+func compressFile(c Compressor, src, dst string) (err error) {
+	sf, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer sf.Close()
+
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cerr := df.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	w, err := c.NewWriter(df)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(w, sf); err != nil {
+		w.Close()
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	return df.Sync()
+}
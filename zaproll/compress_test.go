@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type nopCompressor struct{}
+
+func (nopCompressor) Ext() string {
+	return ".nop"
+}
+
+func (nopCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (nopCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestRegisterCompressor(t *testing.T) {
+
+	if RegisterCompressor("gzip", gzipCompressor{}) == nil {
+		t.Fatal("should fail to register dup name")
+	}
+	if RegisterCompressor("", nopCompressor{}) == nil {
+		t.Fatal("should fail to register empty name")
+	}
+	if err := RegisterCompressor("nop", nopCompressor{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_compressorMutex.Lock()
+		delete(_compressors, "nop")
+		_compressorMutex.Unlock()
+	}()
+	c, err := getCompressor("nop")
+	if err != nil || c.Ext() != ".nop" {
+		t.Fatal("mismatch compressor", err)
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	_, err = New(&Config{OutputPath: filepath.Join(dir, "a.log"), Compress: "unknown"})
+	if err == nil {
+		t.Fatal("should fail with unknown compressor")
+	}
+}
+
+func TestParseTime_Compressed(t *testing.T) {
+	now := time.Now()
+	fn := "zaproll-test.log"
+	prefix, ext := getPrefixAndExt(fn)
+	fp, ts := makeBackupFP(fn, false, now)
+
+	if parseTime(fp+".gz", prefix, ext) != ts {
+		t.Fatal("should recognize compressed backup")
+	}
+	if parseTime(fp+".gz.tmp", prefix, ext) != 0 {
+		t.Fatal("should not recognize temporary file")
+	}
+	if parseTime(fp+".xz", prefix, ext) != 0 {
+		t.Fatal("should not recognize unknown compressor")
+	}
+}
+
+// waitCompressed waits until all backups are compressed.
+func waitCompressed(t *testing.T, output string) []string {
+	for i := 0; ; i++ {
+		fps, err := ListBackups(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := true
+		for _, fp := range fps {
+			if !strings.HasSuffix(fp, ".gz") {
+				done = false
+			}
+		}
+		if done {
+			return fps
+		}
+		if i > 5000 {
+			t.Fatal("timeout waiting for compressing")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func readBackup(t *testing.T, fp string) []byte {
+	f, err := OpenBackup(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRotation_Compress(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	r, err := New(&Config{
+		OutputPath:   fp,
+		MaxSize:      32,
+		MaxBackups:   8,
+		PerWriteSize: 4,
+		PerSyncSize:  16,
+		Compress:     "gzip",
+		Developed:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var written []byte
+	for i := 0; i < 3; i++ {
+		p := bytes.Repeat([]byte{'a' + byte(i)}, 32)
+		written = append(written, p...)
+		r.Write(p)
+		time.Sleep(2 * time.Millisecond) // Avoid backups with the same name.
+	}
+
+	fps := waitCompressed(t, fp)
+	if len(fps) == 0 {
+		t.Fatal("should have backups")
+	}
+	var read []byte
+	for _, b := range fps {
+		read = append(read, readBackup(t, b)...)
+	}
+	if !bytes.Equal(read, written[:len(read)]) {
+		t.Fatal("backups content mismatch")
+	}
+
+	r.locker.Lock()
+	for _, b := range r.backups.bs {
+		if !strings.HasSuffix(b.fp, ".gz") {
+			t.Fatal("backups should be updated after compressing")
+		}
+	}
+	r.locker.Unlock()
+}
+
+func TestRotation_CompressRetention(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	cfg := &Config{
+		OutputPath:   fp,
+		MaxSize:      8,
+		MaxBackups:   2,
+		PerWriteSize: 4,
+		PerSyncSize:  8,
+		Compress:     "gzip",
+		Developed:    true,
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		r.Write(make([]byte, 8))
+		time.Sleep(2 * time.Millisecond)
+	}
+	r.Close()
+
+	fps, err := ListBackups(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) > cfg.MaxBackups {
+		t.Fatal("too many backups", len(fps))
+	}
+	ns, _ := ioutil.ReadDir(dir)
+	if len(ns) > cfg.MaxBackups+1 {
+		t.Fatal("too many files", len(ns))
+	}
+}
+
+// The moved log file is compressed after reopening if it failed to open the
+// new one in rotation, but not while it's still written to.
+func TestRotation_CompressRotateOpenError(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	clk := newFakeClock(time.Now())
+	r, err := prepare(&Config{OutputPath: fp, Compress: "gzip", Developed: true}, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	openFile := r.openFile
+	r.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if flag&os.O_TRUNC != 0 {
+			return nil, syscall.ENOSPC
+		}
+		return openFile(name, flag, perm)
+	}
+	r.Write([]byte("ab"))
+	if err = r.Rotate(); err == nil {
+		t.Fatal("should fail to open new log file")
+	}
+	r.locker.Lock()
+	pending := len(r.pending)
+	r.locker.Unlock()
+	if pending != 0 {
+		t.Fatal("should not compress the file being written")
+	}
+
+	clk.set(clk.Now().Add(retryInterval))
+	if err = r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	fps := waitCompressed(t, fp)
+	if len(fps) != 1 || string(readBackup(t, fps[0])) != "ab" {
+		t.Fatal("moved file should be compressed after reopening", fps)
+	}
+}
+
+// Backups left uncompressed (e.g. crashed) will be compressed by next Rotation.
+func TestRotation_CompressLeft(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	backup, _ := makeBackupFP(fp, false, time.Now())
+	if err = ioutil.WriteFile(backup, []byte("left"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmp := backup + ".gz" + compressTmpExt
+	if err = ioutil.WriteFile(tmp, []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(&Config{OutputPath: fp, Compress: "gzip", Developed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	fps := waitCompressed(t, fp)
+	if len(fps) != 1 || fps[0] != backup+".gz" {
+		t.Fatal("mismatch backups", fps)
+	}
+	if string(readBackup(t, fps[0])) != "left" {
+		t.Fatal("backup content mismatch")
+	}
+	if _, err = os.Stat(backup); !os.IsNotExist(err) {
+		t.Fatal("uncompressed backup should be removed")
+	}
+	if _, err = os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("temporary file should be removed")
+	}
+}
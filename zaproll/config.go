@@ -18,10 +18,40 @@ type Config struct {
 	MaxSize int64 `json:"max_size_mb" toml:"max_size_mb"`
 	// MaxBackups is the maximum number of backup log files to retain.
 	MaxBackups int `json:"max_backups" toml:"max_backups"`
+	// MaxAge is the maximum days to retain backup log files,
+	// based on the timestamp in their names.
+	// Unit: day.
+	// Default: 0 (no limit).
+	MaxAge int `json:"max_age_days" toml:"max_age_days"`
+	// MaxTotalSize is the maximum total size of backup log files
+	// (compressed size if they're compressed).
+	// Unit: MB.
+	// Default: 0 (no limit).
+	MaxTotalSize int64 `json:"max_total_size_mb" toml:"max_total_size_mb"`
 	// LocalTime is the timestamp in backup log file. Default is to use UTC time.
 	// If true, use local time.
+	// It's also the zone of RotateAt.
 	LocalTime bool `json:"local_time" toml:"local_time"`
 
+	// RotateEvery is the interval of time-based rotation,
+	// e.g. 3600 for hourly, 86400 for daily.
+	// It works with MaxSize together, whichever comes first.
+	// Intervals restart from midnight every day (wall clock, DST aware),
+	// intervals longer than a day are rounded down to whole days.
+	// Unit: second.
+	// Default: 0 (disabled). If RotateAt is set, it's 86400.
+	RotateEvery int64 `json:"rotate_every" toml:"rotate_every"`
+	// RotateAt is the offset of time-based rotations from midnight,
+	// e.g. RotateEvery=86400 with RotateAt=7200 rotates at 02:00 every day.
+	// Unit: second.
+	// Default: 0 (at midnight, or on the hour).
+	RotateAt int64 `json:"rotate_at" toml:"rotate_at"`
+
+	// Compress is the name of compressor compressing backups in background,
+	// e.g. "gzip". More compressors could be added by RegisterCompressor.
+	// Default: "" (no compression).
+	Compress string `json:"compress" toml:"compress"`
+
 	// PerWriteSize is zaproll's write size,
 	// zaproll writes data to page cache every PerWriteSize.
 	// Unit: KB.
@@ -40,6 +70,13 @@ type Config struct {
 	// and it shouldn't be too large, avoiding burst I/O.
 	PerSyncSize int64 `json:"per_sync_size" toml:"per_sync_size"`
 
+	// ErrorHandler is called when Rotation meets an error (e.g. disk is full),
+	// Write & Sync return the error too.
+	// After that, Rotation will try to recover (reopen log file) every second
+	// when there is Write or Sync.
+	// It's called with Rotation locked, so it mustn't call Rotation's methods.
+	ErrorHandler func(err error) `json:"-" toml:"-"`
+
 	// Develop mode. Default is false.
 	// It' used for testing, if it's true, the page cache control unit could not be aligned to page cache size.
 	Developed bool `json:"developed" toml:"developed"`
@@ -76,6 +113,27 @@ func (c *Config) adjust() {
 	if c.MaxBackups <= 0 {
 		c.MaxBackups = defaultMaxBackups
 	}
+	if c.MaxAge < 0 {
+		c.MaxAge = 0
+	}
+	if c.MaxTotalSize < 0 {
+		c.MaxTotalSize = 0
+	} else {
+		c.MaxTotalSize = c.MaxTotalSize * m
+	}
+
+	if c.RotateEvery <= 0 {
+		c.RotateEvery = 0
+		if c.RotateAt > 0 {
+			c.RotateEvery = 86400
+		}
+	}
+	if c.RotateEvery > 0 {
+		c.RotateAt %= c.RotateEvery
+		if c.RotateAt < 0 {
+			c.RotateAt += c.RotateEvery
+		}
+	}
 
 	if c.PerWriteSize <= 0 {
 		c.PerWriteSize = defaultPerWriteSize
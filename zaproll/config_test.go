@@ -52,6 +52,41 @@ func TestConfigDevelop(t *testing.T) {
 	}
 }
 
+func TestConfigRetention(t *testing.T) {
+	cfg := &Config{MaxAge: -1, MaxTotalSize: -1}
+	cfg.adjust()
+	if cfg.MaxAge != 0 || cfg.MaxTotalSize != 0 {
+		t.Fatal("mismatch")
+	}
+
+	cfg = &Config{MaxAge: 7, MaxTotalSize: 2}
+	cfg.adjust()
+	if cfg.MaxAge != 7 || cfg.MaxTotalSize != 2*mb {
+		t.Fatal("mismatch")
+	}
+}
+
+func TestConfigRotateTime(t *testing.T) {
+	tests := []struct {
+		every, at       int64
+		expEvery, expAt int64
+	}{
+		{0, 0, 0, 0},
+		{-1, 0, 0, 0},
+		{0, 7200, 86400, 7200},
+		{3600, 0, 3600, 0},
+		{3600, 5400, 3600, 1800},
+		{3600, -1800, 3600, 1800},
+	}
+	for i, tt := range tests {
+		cfg := &Config{RotateEvery: tt.every, RotateAt: tt.at}
+		cfg.adjust()
+		if cfg.RotateEvery != tt.expEvery || cfg.RotateAt != tt.expAt {
+			t.Fatal("mismatch", i, cfg.RotateEvery, cfg.RotateAt)
+		}
+	}
+}
+
 func TestAlignToPage(t *testing.T) {
 	for i := 1; i <= pageSize; i++ {
 		if alignToPage(int64(i)) != pageSize {
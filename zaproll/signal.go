@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// HandleSignals calls fn (e.g. Rotation.Rotate or Rotation.Reopen) on signals,
+// SIGHUP & SIGUSR1 by default (SIGHUP only on Windows).
+//
+// The error returned by fn is dropped. Rotation.Rotate and Rotation.Reopen
+// report their I/O errors by Config.ErrorHandler, but not the errors returned
+// directly (e.g. ErrClosed, or the last error before retrying),
+// wrap fn to handle them if needed.
+//
+// It's opt-in, and returns a function to stop handling. e.g.
+//
+//	stop := zaproll.HandleSignals(r.Reopen) // Log file moved by logrotate.
+//	defer stop()
+func HandleSignals(fn func() error, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = defaultSignals
+	}
+
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-c:
+				_ = fn()
+			case <-done:
+				return
+			}
+		}
+	}()
+	signal.Notify(c, sigs...)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+			wg.Wait()
+		})
+	}
+}
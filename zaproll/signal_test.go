@@ -0,0 +1,71 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestHandleSignals(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	called := make(chan struct{}, 1)
+	stop := HandleSignals(func() error {
+		called <- struct{}{}
+		return nil
+	})
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for signal")
+	}
+
+	stop()
+	stop() // Stop twice.
+}
+
+func TestHandleSignals_Rotate(t *testing.T) {
+
+	fn := func(tr *testRotation) {
+		r := tr.r
+		r.Write([]byte("ab"))
+
+		stop := HandleSignals(r.Rotate, syscall.SIGHUP)
+		defer stop()
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			tr.Fatal(err)
+		}
+
+		for i := 0; ; i++ {
+			fps, err := ListBackups(r.cfg.OutputPath)
+			if err != nil {
+				tr.Fatal(err)
+			}
+			if len(fps) == 1 {
+				break
+			}
+			if i > 5000 {
+				tr.Fatal("timeout waiting for rotation")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	runTest(t, fn)
+}
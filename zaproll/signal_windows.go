@@ -0,0 +1,15 @@
+/*
+ * Copyright (c) 2020. Temple3x (temple3x@gmail.com)
+ *
+ * Use of this source code is governed by the MIT License
+ * that can be found in the LICENSE file.
+ */
+
+package zaproll
+
+import (
+	"os"
+	"syscall"
+)
+
+var defaultSignals = []os.Signal{syscall.SIGHUP}
@@ -10,6 +10,12 @@
 //
 // zaproll use buffer writer to improve I/O throughput,
 // and there is only one goroutine could write, so Mutex is light.
+//
+// Log file is rotated when its size reaches MaxSize,
+// or on time if RotateEvery is set (e.g. hourly, daily at midnight).
+// Backups could be compressed in background (see Config.Compress).
+// Rotate & Reopen make it at once, and they could be triggered by signals
+// (see HandleSignals).
 package zaproll
 
 import (
@@ -24,13 +30,41 @@ import (
 	"github.com/templexxx/fnc"
 )
 
+// ErrClosed is returned by Write & Sync after Rotation closed.
+var ErrClosed = errors.New("zaproll: rotation closed")
+
+// retryInterval is the minimum interval of recovering from error.
+const retryInterval = time.Second
+
 // Rotation is implement io.WriteCloser interface with func Sync() (err error).
 type Rotation struct {
 	locker sync.Mutex
+	closed bool
 
 	cfg *Config
 
+	// err is the last error of writing, nil if it's healthy.
+	// Rotation will try to recover after retryTime.
+	err       error
+	retryTime time.Time
+	openFile  func(name string, flag int, perm os.FileMode) (*os.File, error)
+
+	clock clock
+	// nextRotate is the time of next time-based rotation,
+	// zero if it's disabled.
+	nextRotate time.Time
+	done       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+
 	backups *Backups
+	// moved is the backup which is still written to, because it failed to
+	// open the new log file after moving it. It's done after reopening.
+	moved string
+
+	compressor Compressor
+	pending    []string // Backups waiting for compressing.
+	compressC  chan struct{}
 
 	f       *os.File
 	buf     *bufIO
@@ -42,7 +76,7 @@ type Rotation struct {
 // New creates a Rotation.
 func New(cfg *Config) (r *Rotation, err error) {
 
-	r, err = prepare(cfg)
+	r, err = prepare(cfg, systemClock{})
 	if err != nil {
 		return
 	}
@@ -50,7 +84,7 @@ func New(cfg *Config) (r *Rotation, err error) {
 	return
 }
 
-func prepare(cfg *Config) (r *Rotation, err error) {
+func prepare(cfg *Config, clk clock) (r *Rotation, err error) {
 
 	if cfg.OutputPath == "" {
 		return nil, errors.New("empty log file path")
@@ -58,48 +92,121 @@ func prepare(cfg *Config) (r *Rotation, err error) {
 
 	cfg.adjust()
 
-	r = &Rotation{cfg: cfg}
+	r = &Rotation{cfg: cfg, clock: clk, done: make(chan struct{}), openFile: fnc.OpenFile}
+	if cfg.Compress != "" {
+		r.compressor, err = getCompressor(cfg.Compress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	bs, err := listBackups(cfg.OutputPath, cfg.MaxBackups)
 	if err != nil {
 		return
 	}
 	r.backups = bs
+	r.retain()
 
-	err = r.open()
+	_, err = r.open()
 	if err != nil {
 		return
 	}
 
 	r.buf = newBufIO(r.f, int(r.cfg.PerWriteSize))
 
+	if cfg.RotateEvery > 0 {
+		r.nextRotate = nextRotateTime(r.now(), r.rotateEvery(), r.rotateAt())
+		r.wg.Add(1)
+		go r.rotateLoop()
+	}
+
+	if r.compressor != nil {
+		r.compressC = make(chan struct{}, 1)
+		for _, b := range r.backups.bs { // Left by the last Rotation.
+			r.compressLater(b.fp)
+		}
+		r.wg.Add(1)
+		go r.compressLoop()
+	}
+
 	return
 }
 
+// retain removes backups out of the limits of config.
+func (r *Rotation) retain() {
+	maxAge := time.Duration(r.cfg.MaxAge) * 24 * time.Hour
+	r.backups.retain(r.cfg.MaxBackups, maxAge, r.cfg.MaxTotalSize, r.clock.Now())
+}
+
+func (r *Rotation) now() time.Time {
+	t := r.clock.Now()
+	if !r.cfg.LocalTime {
+		t = t.UTC()
+	}
+	return t
+}
+
+func (r *Rotation) rotateEvery() time.Duration {
+	return time.Duration(r.cfg.RotateEvery) * time.Second
+}
+
+func (r *Rotation) rotateAt() time.Duration {
+	return time.Duration(r.cfg.RotateAt) * time.Second
+}
+
+// rotateLoop rotates log file on time when there is no Write/Sync.
+func (r *Rotation) rotateLoop() {
+	defer r.wg.Done()
+
+	for {
+		r.locker.Lock()
+		next := r.nextRotate
+		r.locker.Unlock()
+
+		d := next.Sub(r.clock.Now())
+		if d < 0 {
+			d = 0
+		}
+		c, stop := r.clock.NewTimer(d)
+		select {
+		case <-c:
+			r.locker.Lock()
+			r.rotateOnTime()
+			r.locker.Unlock()
+		case <-r.done:
+			stop()
+			return
+		}
+	}
+}
+
 // open opens a new log file.
-// If log file existed, move it to backups.
-func (r *Rotation) open() (err error) {
+// If log file existed, move it to backups and return the backup's path,
+// even if it fails to open the new one.
+func (r *Rotation) open() (backupFP string, err error) {
 
 	fp := r.cfg.OutputPath
 
 	if r.f != nil { // File exist may happen in rotation process.
-		backupFP, t := makeBackupFP(fp, r.cfg.LocalTime, time.Now())
+		var t int64
+		backupFP, t = makeBackupFP(fp, r.cfg.LocalTime, r.clock.Now())
 		err = os.Rename(fp, backupFP)
 		if err != nil {
-			return fmt.Errorf("failed to rename log file, output: %s backup: %s", fp, backupFP)
+			return "", fmt.Errorf("failed to rename log file, output: %s backup: %s: %s", fp, backupFP, err.Error())
 		}
 
-		heap.Push(r.backups, Backup{t, backupFP})
-		if r.backups.Len() > r.cfg.MaxBackups {
-			v := heap.Pop(r.backups)
-			os.Remove(v.(Backup).fp)
+		var size int64
+		if fi, err := os.Stat(backupFP); err == nil {
+			size = fi.Size()
 		}
+		heap.Push(r.backups, Backup{t, backupFP, size})
 	}
 
 	// Create a new log file.
 	dir := filepath.Dir(fp)
 	err = os.MkdirAll(dir, 0755) // ensure we have created the right dir.
 	if err != nil {
-		return fmt.Errorf("failed to make dirs for log file: %s", err.Error())
+		return backupFP, fmt.Errorf("failed to make dirs for log file: %s", err.Error())
 	}
 	// Truncate here to clean up file content if someone else creates
 	// the file between exist checking and create file.
@@ -107,9 +214,9 @@ func (r *Rotation) open() (err error) {
 	//
 	// Most of log shippers monitor file size, and APPEND only can avoid Read-Modify-Write.
 	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC | os.O_APPEND
-	f, err := fnc.OpenFile(fp, flag, 0644)
+	f, err := r.openFile(fp, flag, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create log file: %s", err.Error())
+		return backupFP, fmt.Errorf("failed to create log file: %s", err.Error())
 	}
 
 	r.f = f
@@ -122,9 +229,22 @@ func (r *Rotation) Write(p []byte) (written int, err error) {
 	r.locker.Lock()
 	defer r.locker.Unlock()
 
-	_, fw, _ := r.buf.write(p)
+	if r.closed {
+		return 0, ErrClosed
+	}
+	if err = r.recover(); err != nil {
+		return 0, err
+	}
+
+	r.rotateOnTime()
+
+	nn, fw, err := r.buf.write(p)
 	r.dirty += int64(fw)
 	r.written += int64(fw)
+	if err != nil {
+		r.fail(err)
+		return nn, err
+	}
 
 	if fw == 0 { // Nothing write to file, just memory copy.
 		return len(p), nil
@@ -141,15 +261,100 @@ func (r *Rotation) Sync() (err error) {
 	r.locker.Lock()
 	defer r.locker.Unlock()
 
-	fw, _ := r.buf.flush()
+	if r.closed {
+		return ErrClosed
+	}
+	if err = r.recover(); err != nil {
+		return
+	}
+
+	r.rotateOnTime()
+
+	fw, err := r.buf.flush()
 	r.dirty += int64(fw)
 	r.written += int64(fw)
+	if err != nil {
+		r.fail(err)
+		return
+	}
 
 	r.flushDirty(true)
 
 	return
 }
 
+// fail records the error & reports it.
+func (r *Rotation) fail(err error) {
+	r.err = err
+	r.retryTime = r.clock.Now().Add(retryInterval)
+	r.report(err)
+}
+
+func (r *Rotation) report(err error) {
+	if h := r.cfg.ErrorHandler; h != nil {
+		h(err)
+	}
+}
+
+// recover tries to recover from the last error by reopening the log file,
+// then writes the data left in buffer.
+// It returns the error if it's still unhealthy.
+func (r *Rotation) recover() error {
+	if r.err == nil {
+		return nil
+	}
+	if r.clock.Now().Before(r.retryTime) {
+		return r.err
+	}
+
+	if err := r.reopen(); err != nil {
+		r.fail(err)
+		return err
+	}
+	r.buf.clearErr()
+	fw, err := r.buf.flush()
+	r.dirty += int64(fw)
+	r.written += int64(fw)
+	if err != nil {
+		r.fail(err)
+		return err
+	}
+	r.err = nil
+	return nil
+}
+
+// reopen reopens the log file without truncating,
+// the file may have been removed or the fd may be broken.
+func (r *Rotation) reopen() error {
+	fp := r.cfg.OutputPath
+	err := os.MkdirAll(filepath.Dir(fp), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to make dirs for log file: %s", err.Error())
+	}
+	f, err := r.openFile(fp, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen log file: %s", err.Error())
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to reopen log file: %s", err.Error())
+	}
+
+	r.f.Close()
+	r.f = f
+	r.buf.reset(f)
+	r.written = fi.Size()
+	r.synced = r.written
+	r.dirty = 0
+	if r.moved != "" {
+		r.retain()
+		r.compressLater(r.moved)
+		r.moved = ""
+	}
+	return nil
+}
+
 func (r *Rotation) flushDirty(force bool) {
 	if r.dirty >= r.cfg.PerSyncSize || force {
 
@@ -159,27 +364,150 @@ func (r *Rotation) flushDirty(force bool) {
 	}
 
 	if r.written >= r.cfg.MaxSize {
-		oldF := r.f
-		err := r.open()
-		if err == nil {
-			fnc.FlushHint(oldF, 0, r.cfg.MaxSize)
-			fnc.DropCache(oldF, 0, r.cfg.MaxSize)
-			oldF.Close()
-			r.buf.reset(r.f)
-		}
+		r.rotate()
+	}
+}
 
-		r.dirty = 0
-		r.written = 0
-		r.synced = 0
+// rotateOnTime rotates log file if it's the time,
+// buffered data belongs to the old file.
+// The empty file won't be rotated.
+func (r *Rotation) rotateOnTime() {
+	if r.nextRotate.IsZero() {
+		return
+	}
+	now := r.now()
+	if now.Before(r.nextRotate) {
+		return
+	}
+	r.nextRotate = nextRotateTime(now, r.rotateEvery(), r.rotateAt())
+	if r.err != nil { // Skip this one, it'll recover in Write/Sync.
+		return
+	}
+
+	fw, err := r.buf.flush()
+	r.dirty += int64(fw)
+	r.written += int64(fw)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	if r.written == 0 {
+		return
+	}
+	r.rotate()
+}
+
+// rotate moves the log file to backups and opens a new one.
+func (r *Rotation) rotate() error {
+	oldF := r.f
+	backupFP, err := r.open()
+	switch {
+	case err == nil:
+		fnc.FlushHint(oldF, 0, r.written)
+		fnc.DropCache(oldF, 0, r.written)
+		oldF.Close()
+		r.buf.reset(r.f)
+		// Remove or compress it after closing.
+		r.retain()
+		r.compressLater(backupFP)
+	case backupFP != "":
+		// The old file has been moved, reopen OutputPath in Write/Sync.
+		r.moved = backupFP
+		r.fail(err)
+	default:
+		r.report(err) // Keep writing the old one.
+	}
+
+	r.dirty = 0
+	r.written = 0
+	r.synced = 0
+	return err
+}
+
+// Rotate moves the log file to backups and opens a new one at once,
+// buffered data belongs to the old file.
+func (r *Rotation) Rotate() (err error) {
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if err = r.recover(); err != nil {
+		return
+	}
+
+	fw, err := r.buf.flush()
+	r.dirty += int64(fw)
+	r.written += int64(fw)
+	if err != nil {
+		r.fail(err)
+		return
+	}
+	return r.rotate()
+}
+
+// Reopen reopens the log file at OutputPath, it's used when the log file has
+// been moved by others (e.g. logrotate). Buffered data belongs to the moved file.
+//
+// It also recovers Rotation from error at once.
+func (r *Rotation) Reopen() (err error) {
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return ErrClosed
 	}
+
+	// If it fails, the data left will be written to the new file.
+	fw, _ := r.buf.flush()
+	r.dirty += int64(fw)
+	r.written += int64(fw)
+	fnc.FlushHint(r.f, r.synced, r.dirty)
+
+	if err = r.reopen(); err != nil {
+		r.fail(err)
+		return
+	}
+	r.buf.clearErr()
+	r.err = nil
+	return
 }
 
-// Close closes Rotation and release all resources.
+// Close flushes buffered data to the disk, and closes Rotation.
+// Write & Sync will return ErrClosed after that,
+// and Close returns ErrClosed if it has been closed.
 func (r *Rotation) Close() (err error) {
 
-	if r.f != nil { // Just in case.
-		return r.f.Close()
+	// Background goroutines need the locker,
+	// so stop them before locking.
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+	})
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return ErrClosed
 	}
+	r.closed = true
+
+	fw, err := r.buf.flush()
+	r.dirty += int64(fw)
+	r.written += int64(fw)
+	fnc.FlushHint(r.f, r.synced, r.dirty)
+	r.synced += r.dirty
+	r.dirty = 0
 
+	if serr := r.f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
 	return
 }
@@ -15,7 +15,12 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"go.uber.org/goleak"
 )
 
 var testConfig = &Config{
@@ -176,10 +181,12 @@ func TestRotation_WriteMaxSizeConcurrent(t *testing.T) {
 				for i, v := range p[int64(i)*pLen/2 : int64(i)*pLen/2+pLen/2] {
 					n, err := r.Write([]byte{v})
 					if err != nil {
-						tr.Fatal(err, i)
+						tr.Error(err, i)
+						return
 					}
 					if n != 1 {
-						tr.Fatal("written mismatch")
+						tr.Error("written mismatch")
+						return
 					}
 				}
 
@@ -198,6 +205,627 @@ func TestRotation_WriteMaxSizeConcurrent(t *testing.T) {
 	runTest(t, fn)
 }
 
+func TestRotation_Close(t *testing.T) {
+
+	fn := func(tr *testRotation) {
+		r := tr.r
+
+		p := make([]byte, r.cfg.PerWriteSize-1) // Buffered only.
+		rand.Read(p)
+		r.Write(p)
+		if !isMatchFileSize(0, r.cfg.OutputPath) {
+			tr.Fatal("should be buffered")
+		}
+
+		if err := r.Close(); err != nil {
+			tr.Fatal(err)
+		}
+		if !isMatchFileContent(p, r.cfg.OutputPath) || !isMatchFileSize(int64(len(p)), r.cfg.OutputPath) {
+			tr.Fatal("buffered data should be flushed")
+		}
+
+		if _, err := r.Write(p); err != ErrClosed {
+			tr.Fatal("Write should return ErrClosed", err)
+		}
+		if err := r.Sync(); err != ErrClosed {
+			tr.Fatal("Sync should return ErrClosed", err)
+		}
+		if err := r.Close(); err != ErrClosed {
+			tr.Fatal("Close should return ErrClosed", err)
+		}
+		if !isMatchFileSize(int64(len(p)), r.cfg.OutputPath) {
+			tr.Fatal("should not write after closed")
+		}
+	}
+	runTest(t, fn)
+}
+
+// Close concurrent with Write, all data written before Close must be in file.
+func TestRotation_CloseConcurrent(t *testing.T) {
+
+	fn := func(tr *testRotation) {
+		r := tr.r
+
+		var wg sync.WaitGroup
+		var written int64
+		n := int(r.cfg.MaxSize-1) / 4 // Avoiding create new file.
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < n; j++ {
+					if _, err := r.Write([]byte{'1'}); err != nil {
+						if err != ErrClosed {
+							tr.Error(err)
+						}
+						return
+					}
+					atomic.AddInt64(&written, 1)
+					time.Sleep(10 * time.Microsecond)
+				}
+			}()
+		}
+		time.Sleep(50 * time.Microsecond)
+		if err := r.Close(); err != nil {
+			tr.Fatal(err)
+		}
+		wg.Wait()
+
+		if !isMatchFileSize(atomic.LoadInt64(&written), r.cfg.OutputPath) {
+			tr.Fatal("mismatch written")
+		}
+	}
+	runTest(t, fn)
+}
+
+// faultyWriter always fails like a full disk.
+type faultyWriter struct{}
+
+func (faultyWriter) Write(p []byte) (int, error) {
+	return 0, syscall.ENOSPC
+}
+
+func TestRotation_ErrorRecovery(t *testing.T) {
+
+	clk := newFakeClock(time.Now())
+	e, clear := makeTimeTestEnv(t, clk, 0)
+	defer clear()
+	r := e.r
+
+	var errs []error
+	r.cfg.ErrorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+	r.buf.reset(faultyWriter{})
+
+	if _, err := r.Write([]byte("ab")); err != nil { // Buffered.
+		t.Fatal(err)
+	}
+	n, err := r.Write([]byte("cdef"))
+	if err != syscall.ENOSPC || n != 2 {
+		t.Fatal("should return the error", n, err)
+	}
+	if len(errs) != 1 || errs[0] != syscall.ENOSPC {
+		t.Fatal("should call ErrorHandler", errs)
+	}
+
+	// Before retrying, errors are returned without reporting again.
+	if _, err = r.Write([]byte("x")); err != syscall.ENOSPC {
+		t.Fatal("should return the last error", err)
+	}
+	if err = r.Sync(); err != syscall.ENOSPC {
+		t.Fatal("should return the last error", err)
+	}
+	if len(errs) != 1 {
+		t.Fatal("should not report again", errs)
+	}
+
+	// Failed to recover.
+	openFile := r.openFile
+	r.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		return nil, syscall.ENOSPC
+	}
+	clk.set(clk.Now().Add(retryInterval))
+	if _, err = r.Write([]byte("x")); err == nil {
+		t.Fatal("should fail to reopen")
+	}
+	if len(errs) != 2 {
+		t.Fatal("should report the reopening error", errs)
+	}
+
+	// Recovered, the buffered data is written.
+	r.openFile = openFile
+	clk.set(clk.Now().Add(retryInterval))
+	if _, err = r.Write([]byte("gh")); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if !isMatchFileContent([]byte("abcdgh"), e.fp) || !isMatchFileSize(6, e.fp) {
+		t.Fatal("log file content mismatch")
+	}
+	if len(errs) != 2 {
+		t.Fatal("mismatch errors", errs)
+	}
+}
+
+func TestRotation_RotateOpenError(t *testing.T) {
+
+	clk := newFakeClock(time.Now())
+	e, clear := makeTimeTestEnv(t, clk, 0)
+	defer clear()
+	r := e.r
+
+	var errs []error
+	r.cfg.ErrorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+
+	// Fail to create the new log file after moving the old one.
+	openFile := r.openFile
+	r.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if flag&os.O_TRUNC != 0 {
+			return nil, syscall.ENOSPC
+		}
+		return openFile(name, flag, perm)
+	}
+	r.Write([]byte("ab"))
+	if err := r.Rotate(); err == nil {
+		t.Fatal("should fail to open new log file")
+	}
+	if len(errs) != 1 {
+		t.Fatal("should report the opening error", errs)
+	}
+	if _, err := r.Write([]byte("x")); err == nil {
+		t.Fatal("should not write to the moved file")
+	}
+	fps, err := ListBackups(e.fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != 1 || !isMatchFileContent([]byte("ab"), fps[0]) {
+		t.Fatal("old log file should be in the backup")
+	}
+
+	// Reopen OutputPath on the next retry.
+	clk.set(clk.Now().Add(retryInterval))
+	if _, err = r.Write([]byte("cd")); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if !isMatchFileContent([]byte("cd"), e.fp) {
+		t.Fatal("log file content mismatch")
+	}
+
+	// Rotations work again.
+	r.openFile = openFile
+	if err = r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if countBackups(t, e.fp) != 2 {
+		t.Fatal("mismatch backups count")
+	}
+}
+
+func TestRotation_Rotate(t *testing.T) {
+
+	fn := func(tr *testRotation) {
+		r := tr.r
+		fp := r.cfg.OutputPath
+
+		r.Write([]byte("ab")) // Buffered.
+		if err := r.Rotate(); err != nil {
+			tr.Fatal(err)
+		}
+		fps, err := ListBackups(fp)
+		if err != nil {
+			tr.Fatal(err)
+		}
+		if len(fps) != 1 || !isMatchFileContent([]byte("ab"), fps[0]) {
+			tr.Fatal("buffered data should be in the backup")
+		}
+		if !isMatchFileSize(0, fp) {
+			tr.Fatal("new log file should be empty")
+		}
+
+		r.Write([]byte("cd"))
+		r.Sync()
+		if !isMatchFileContent([]byte("cd"), fp) {
+			tr.Fatal("log file content mismatch")
+		}
+
+		r.Close()
+		if err = r.Rotate(); err != ErrClosed {
+			tr.Fatal("should return ErrClosed", err)
+		}
+	}
+	runTest(t, fn)
+}
+
+func TestRotation_Reopen(t *testing.T) {
+
+	fn := func(tr *testRotation) {
+		r := tr.r
+		fp := r.cfg.OutputPath
+		moved := fp + ".1"
+
+		r.Write([]byte("ab"))
+		if err := os.Rename(fp, moved); err != nil {
+			tr.Fatal(err)
+		}
+		if err := r.Reopen(); err != nil {
+			tr.Fatal(err)
+		}
+		if !isMatchFileContent([]byte("ab"), moved) {
+			tr.Fatal("buffered data should be in the moved file")
+		}
+		if !isMatchFileSize(0, fp) {
+			tr.Fatal("should create new log file")
+		}
+
+		// Recover from error at once.
+		r.buf.reset(faultyWriter{})
+		if _, err := r.Write(make([]byte, r.cfg.PerWriteSize+1)); err == nil {
+			tr.Fatal("should fail")
+		}
+		if err := r.Reopen(); err != nil {
+			tr.Fatal(err)
+		}
+		r.Write([]byte("cd"))
+		if err := r.Sync(); err != nil {
+			tr.Fatal(err)
+		}
+		if !isMatchFileContent([]byte("cd"), fp) || !isMatchFileSize(2, fp) {
+			tr.Fatal("log file content mismatch")
+		}
+
+		r.Close()
+		if err := r.Reopen(); err != ErrClosed {
+			tr.Fatal("should return ErrClosed", err)
+		}
+	}
+	runTest(t, fn)
+}
+
+// fakeClock is a clock only moved by Add.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+	c.timers = append(c.timers, t)
+	return t.c, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, v := range c.timers {
+			if v == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Add moves the clock forward and fires the timers expired.
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if !t.at.After(c.now) {
+			t.c <- c.now
+			continue
+		}
+		timers = append(timers, t)
+	}
+	c.timers = timers
+}
+
+// set sets the clock without firing timers.
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// waiting returns the number of timers waiting.
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func makeTimeTestEnv(t *testing.T, clk clock, every int64) (*testEnv, func()) {
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dir, "zaproll-test.log")
+	r, err := prepare(&Config{
+		OutputPath:   fp,
+		MaxSize:      1024,
+		MaxBackups:   16,
+		PerWriteSize: 4,
+		PerSyncSize:  16,
+		RotateEvery:  every,
+		Developed:    true,
+	}, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &testEnv{dir: dir, fp: fp, r: r}
+	return e, e.clear
+}
+
+func countBackups(t *testing.T, output string) int {
+	fps, err := ListBackups(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(fps)
+}
+
+func TestRotation_RotateOnWrite(t *testing.T) {
+
+	clk := newFakeClock(time.Date(2020, 1, 2, 3, 30, 0, 0, time.UTC))
+	e, clear := makeTimeTestEnv(t, clk, 3600)
+	defer clear()
+	r := e.r
+
+	if !r.nextRotate.Equal(time.Date(2020, 1, 2, 4, 0, 0, 0, time.UTC)) {
+		t.Fatal("mismatch next rotation", r.nextRotate)
+	}
+
+	p := []byte("ab") // Buffered.
+	r.Write(p)
+	if countBackups(t, e.fp) != 0 {
+		t.Fatal("should not rotate")
+	}
+
+	clk.set(clk.Now().Add(time.Hour)) // Rotated by Write & Sync, not the timer.
+
+	r.Write([]byte("c"))
+	if countBackups(t, e.fp) != 1 {
+		t.Fatal("should rotate")
+	}
+	fps, _ := ListBackups(e.fp)
+	if !isMatchFileContent(p, fps[0]) || !isMatchFileSize(int64(len(p)), fps[0]) {
+		t.Fatal("buffered data should be in the old file")
+	}
+	if !r.nextRotate.Equal(time.Date(2020, 1, 2, 5, 0, 0, 0, time.UTC)) {
+		t.Fatal("mismatch next rotation", r.nextRotate)
+	}
+
+	clk.set(clk.Now().Add(time.Hour))
+
+	r.Sync()
+	if countBackups(t, e.fp) != 2 {
+		t.Fatal("should rotate by Sync")
+	}
+	if !isMatchFileSize(0, e.fp) {
+		t.Fatal("new file should be empty")
+	}
+}
+
+func TestRotation_RotateOnTimer(t *testing.T) {
+
+	clk := newFakeClock(time.Date(2020, 1, 2, 23, 0, 0, 0, time.UTC))
+	e, clear := makeTimeTestEnv(t, clk, 86400)
+	defer clear()
+	r := e.r
+
+	waitTimer := func() {
+		for i := 0; clk.waiting() == 0; i++ {
+			if i > 5000 {
+				t.Fatal("timeout waiting for timer")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitBackups := func(n int) {
+		for i := 0; countBackups(t, e.fp) != n; i++ {
+			if i > 5000 {
+				t.Fatal("timeout waiting for rotation")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Empty file won't be rotated.
+	waitTimer()
+	clk.Add(time.Hour)
+	waitTimer()
+	if countBackups(t, e.fp) != 0 {
+		t.Fatal("empty file should not be rotated")
+	}
+
+	p := []byte("abc")
+	r.Write(p)
+	clk.Add(23 * time.Hour) // 2020-01-03 23:00.
+	waitTimer()
+	if countBackups(t, e.fp) != 0 {
+		t.Fatal("should not rotate before midnight")
+	}
+	clk.Add(time.Hour)
+	waitBackups(1)
+	fps, _ := ListBackups(e.fp)
+	if !isMatchFileContent(p, fps[0]) {
+		t.Fatal("buffered data should be in the old file")
+	}
+}
+
+func TestRotation_CloseStopsTimer(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	clk := newFakeClock(time.Now())
+	_, clear := makeTimeTestEnv(t, clk, 60)
+	clear()
+	clear() // Close twice.
+}
+
+func TestRotation_RetainOnStart(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	now := time.Now()
+	old, _ := makeBackupFP(fp, false, now.AddDate(0, 0, -8))
+	recent, _ := makeBackupFP(fp, false, now.AddDate(0, 0, -6))
+	for _, b := range []string{old, recent} {
+		if _, err = os.Create(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := prepare(&Config{OutputPath: fp, MaxAge: 7, Developed: true}, newFakeClock(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	fps, err := ListBackups(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != 1 || fps[0] != recent {
+		t.Fatal("mismatch backups", fps)
+	}
+}
+
+func TestRotation_RetainOnRotate(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	cfg := &Config{
+		OutputPath:   fp,
+		MaxSize:      8,
+		MaxBackups:   16,
+		MaxTotalSize: 20,
+		PerWriteSize: 4,
+		PerSyncSize:  8,
+		Developed:    true,
+	}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 6; i++ {
+		r.Write(make([]byte, 8))
+		time.Sleep(2 * time.Millisecond) // Avoid backups with the same name.
+	}
+
+	fps, err := ListBackups(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for _, b := range fps {
+		fi, err := os.Stat(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += fi.Size()
+	}
+	if len(fps) == 0 || total > cfg.MaxTotalSize {
+		t.Fatal("mismatch backups", len(fps), total)
+	}
+	if r.backups.total != total {
+		t.Fatal("mismatch total size", r.backups.total, total)
+	}
+}
+
+// The moved log file is kept if it failed to open the new one in rotation,
+// until it's reopened.
+func TestRotation_RetainRotateOpenError(t *testing.T) {
+
+	dir, err := ioutil.TempDir(os.TempDir(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "zaproll-test.log")
+
+	clk := newFakeClock(time.Now())
+	r, err := prepare(&Config{
+		OutputPath:   fp,
+		MaxSize:      1024,
+		MaxBackups:   16,
+		MaxTotalSize: 4,
+		PerWriteSize: 4,
+		PerSyncSize:  8,
+		Developed:    true,
+	}, clk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	openFile := r.openFile
+	r.openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if flag&os.O_TRUNC != 0 {
+			return nil, syscall.ENOSPC
+		}
+		return openFile(name, flag, perm)
+	}
+	r.Write(make([]byte, 8))
+	if err = r.Rotate(); err == nil {
+		t.Fatal("should fail to open new log file")
+	}
+	if countBackups(t, fp) != 1 {
+		t.Fatal("should not remove the file being written")
+	}
+
+	clk.set(clk.Now().Add(retryInterval))
+	if err = r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if countBackups(t, fp) != 0 {
+		t.Fatal("should remove the backup out of MaxTotalSize after reopening")
+	}
+}
+
 func isMatchFileSize(size int64, output string) bool {
 	f, err := os.OpenFile(output, os.O_RDONLY, 0600)
 	if err != nil {